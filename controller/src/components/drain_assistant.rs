@@ -0,0 +1,292 @@
+/*
+This file contains the component in charge
+of assisting the drain of cordoned nodes: RTResource
+related Pods running on a cordoned node are replaced
+on other nodes before being evicted, most critical first,
+so that routine maintenance does not leave RTResources
+without their replicas.
+*/
+
+use std::{
+    ptr,
+    ffi::c_void,
+    time::Duration
+};
+use kube::{
+    Api,
+    api::{
+        ListParams,
+        Patch,
+        PatchParams
+    }
+};
+use k8s_openapi::api::core::v1::{
+    Node,
+    Pod
+};
+
+use crate::utils::vars::SharedState;
+use crate::utils::vars::ClientContext;
+use crate::utils::configuration::ControllerConfig;
+use crate::utils::rtresource::{
+    RTResource,
+    DRAIN_PROGRESS_ANNOTATION,
+    DRAIN_REPLACEMENT_ANNOTATION,
+    is_retained,
+    is_debug,
+    is_busy
+};
+use crate::components::scheduling::{
+    create_pod,
+    delete_pod
+};
+
+
+
+/*
+Drain progress of a single node
+*/
+struct DrainProgress {
+    remaining: usize,           // RTResource related Pods still running on the node
+    awaiting_replacement: usize, // Pods whose replacement is not running yet
+}
+
+/*
+This function checks whether the node is cordoned.
+*/
+pub fn is_cordoned(node: &Node) -> bool {
+    node.spec
+        .as_ref()
+        .and_then(|s| s.unschedulable)
+        .unwrap_or(false)
+}
+
+/*
+This function returns the value of the given Pod annotation.
+*/
+fn get_annotation(pod: &Pod, key: &str) -> Option<String> {
+    pod.metadata.annotations
+        .as_ref()
+        .and_then(|a| a.get(key))
+        .cloned()
+}
+
+/*
+This function returns the criticality of a managed Pod,
+read from its "criticality" label.
+*/
+fn get_criticality(pod: &Pod) -> u32 {
+    pod.metadata.labels
+        .as_ref()
+        .and_then(|l| l.get("criticality"))
+        .and_then(|c| c.parse().ok())
+        .unwrap_or(u32::MAX)
+}
+
+/*
+This function migrates the RTResource related Pods of a cordoned node.
+For each Pod (most critical first):
+    1. if no running replacement exists yet, a new Pod is created from
+       the RTResource template (the scheduler will not place it on the
+       cordoned node) and its name is recorded on the old Pod;
+    2. once the replacement is running, the old Pod is deleted.
+Since the state is recorded on the Pods themselves, the migration
+resumes correctly at every iteration.
+*/
+async fn drain_node(context: &ClientContext, config: &ControllerConfig, node_name: &str) -> Option<DrainProgress> {
+    let client = context.client.clone();
+    let lp = ListParams::default()
+        .fields(&format!("spec.nodeName={}", node_name))
+        .labels("rtresource_uid");
+    let mut pods: Vec<Pod> = match context.list_pods(&lp).await {
+        Ok(list) => list
+            .into_iter()
+            .filter(|p| !is_retained(p) && !is_debug(p) && p.metadata.deletion_timestamp.is_none())
+            .collect(),
+        Err(e) => {
+            eprintln!("Drain Assistant - An error occurred while listing the pods of node {}: {}", node_name, e);
+            return None;
+        }
+    };
+    pods.sort_by_key(|p| get_criticality(p));
+
+    let mut progress = DrainProgress {
+        remaining: pods.len(),
+        awaiting_replacement: 0,
+    };
+    for pod in pods.iter() {
+        let pod_name = pod.metadata.name.clone().unwrap_or_default();
+        let pod_namespace = pod.metadata.namespace.clone().unwrap_or_default();
+        let namespaced_pods: Api<Pod> = Api::namespaced(client.clone(), &pod_namespace);
+
+        /*
+        If a replacement was already created, we evict the Pod
+        as soon as the replacement is running, unless the Pod is executing
+        deadline-critical work (busy): in that case it is evicted once it
+        reports idle or the busy timeout expires.
+        If the replacement no longer exists, a new one is created.
+        */
+        if let Some(replacement_name) = get_annotation(pod, DRAIN_REPLACEMENT_ANNOTATION) {
+            match namespaced_pods.get_opt(&replacement_name).await {
+                Ok(Some(replacement)) => {
+                    let running = replacement.status
+                        .as_ref()
+                        .and_then(|s| s.phase.as_deref())
+                        == Some("Running");
+                    if running && is_busy(pod, config.busy_timeout) {
+                        println!("Drain Assistant - Pod {} is busy, its eviction is postponed!", pod_name);
+                        progress.awaiting_replacement = progress.awaiting_replacement + 1;
+                    } else if running {
+                        match delete_pod("Drain Assistant".to_string(), client.clone(), pod.clone()).await {
+                            Ok(_) => progress.remaining = progress.remaining - 1,
+                            Err(e) => eprintln!("Drain Assistant - An error occurred while evicting pod {}: {}", pod_name, e),
+                        }
+                    } else {
+                        progress.awaiting_replacement = progress.awaiting_replacement + 1;
+                    }
+                    continue;
+                }
+                Ok(None) => {
+                    println!("Drain Assistant - Replacement {} of pod {} no longer exists, creating a new one!", replacement_name, pod_name);
+                }
+                Err(e) => {
+                    eprintln!("Drain Assistant - An error occurred while retrieving pod {}: {}", replacement_name, e);
+                    progress.awaiting_replacement = progress.awaiting_replacement + 1;
+                    continue;
+                }
+            }
+        }
+
+        /*
+        We create the replacement from the RTResource the Pod belongs to
+        and record its name on the Pod being drained.
+        No replacement is created for RTResources being deleted,
+        whose Pods are handled by their deletion policy.
+        */
+        let labels = pod.metadata.labels.clone().unwrap_or_default();
+        let (rtresource_name, rtresource_namespace) = match (
+            labels.get("rtresource_name"),
+            labels.get("rtresource_namespace")
+        ) {
+            (Some(name), Some(namespace)) => (name.clone(), namespace.clone()),
+            _ => {
+                eprintln!("Drain Assistant - An error occurred while retrieving the RTResource of pod {}!", pod_name);
+                continue;
+            }
+        };
+        let rtresource_api: Api<RTResource> = Api::namespaced(client.clone(), &rtresource_namespace);
+        let rtresource = match rtresource_api.get(&rtresource_name).await {
+            Ok(r) => r,
+            Err(e) => {
+                eprintln!("Drain Assistant - An error occurred while retrieving RTResource {}: {}", rtresource_name, e);
+                continue;
+            }
+        };
+        if rtresource.metadata.deletion_timestamp.is_some() {
+            println!("Drain Assistant - RTResource {} is being deleted, pod {} is not replaced!", rtresource_name, pod_name);
+            continue;
+        }
+        match create_pod("Drain Assistant".to_string(), client.clone(), &rtresource, config).await {
+            Ok(Some(replacement_name)) => {
+                let patch = serde_json::json!({
+                    "metadata": {
+                        "annotations": {
+                            DRAIN_REPLACEMENT_ANNOTATION: replacement_name
+                        }
+                    }
+                });
+                if let Err(e) = namespaced_pods.patch(&pod_name, &PatchParams::default(), &Patch::Merge(&patch)).await {
+                    eprintln!("Drain Assistant - An error occurred while recording the replacement of pod {}: {}", pod_name, e);
+                }
+                progress.awaiting_replacement = progress.awaiting_replacement + 1;
+            }
+            Ok(None) => {
+                eprintln!("Drain Assistant - The replacement of pod {} could not be created!", pod_name);
+            }
+            Err(e) => {
+                eprintln!("{}", e);
+            }
+        }
+    }
+
+    Some(progress)
+}
+
+/*
+This function reports the drain progress of a node
+through an annotation on the Node itself (None removes it).
+*/
+async fn report_drain_progress(nodes_api: &Api<Node>, node_name: &str, progress: Option<&DrainProgress>) {
+    let value = progress.map(|p| format!("remaining={},awaiting-replacement={}", p.remaining, p.awaiting_replacement));
+    let patch = serde_json::json!({
+        "metadata": {
+            "annotations": {
+                DRAIN_PROGRESS_ANNOTATION: value
+            }
+        }
+    });
+    if let Err(e) = nodes_api.patch(node_name, &PatchParams::default(), &Patch::Merge(&patch)).await {
+        eprintln!("Drain Assistant - An error occurred while reporting the drain progress of node {}: {}", node_name, e);
+    }
+}
+
+pub extern "C" fn drain_assistant(thread_data: *mut c_void) -> *mut c_void {
+    unsafe {
+        let shared_state = &mut *(thread_data as *mut SharedState);
+
+        let context = shared_state.context.clone();
+        let nodes_api = shared_state.context.nodes.clone();
+        let config = shared_state.config.clone();
+        let period = Duration::from_secs(config.drain_assist_period);
+
+        shared_state.runtime_handle.block_on(async {
+            let mut error_count: usize = 0;
+            let lp = ListParams::default();
+            'outer: loop {
+                /*
+                We periodically list the cluster nodes: cordoned nodes
+                are drained, while the drain progress annotation is removed
+                from nodes that are schedulable again.
+                */
+                match nodes_api.list(&lp).await {
+                    Ok(list) => {
+                        error_count = 0;
+                        for node in list.items.iter() {
+                            let node_name = node.metadata.name.clone().unwrap_or_default();
+                            let reported = node.metadata.annotations
+                                .as_ref()
+                                .map(|a| a.contains_key(DRAIN_PROGRESS_ANNOTATION))
+                                .unwrap_or(false);
+                            if is_cordoned(node) {
+                                if let Some(progress) = drain_node(&context, &config, &node_name).await {
+                                    println!(
+                                        "Drain Assistant - Node {}: {} RT pods remaining, {} awaiting replacement",
+                                        node_name,
+                                        progress.remaining,
+                                        progress.awaiting_replacement
+                                    );
+                                    report_drain_progress(&nodes_api, &node_name, Some(&progress)).await;
+                                }
+                            } else if reported {
+                                report_drain_progress(&nodes_api, &node_name, None).await;
+                            }
+                        }
+                    }
+                    Err(e) => {
+                        eprintln!("Drain Assistant - An error occurred while listing nodes: {}", e);
+                        error_count = error_count + 1;
+                        if error_count >= 10 {
+                            eprintln!("Drain Assistant - Too many errors occurred while listing nodes! Exiting...");
+                            break 'outer;
+                        }
+                    }
+                }
+                tokio::time::sleep(period).await;
+            }
+        });
+
+        println!("Drain Assistant - Something went wrong, cordoned nodes will no longer be drained! Restart the controller to recover!");
+    }
+
+    ptr::null_mut()
+}
@@ -3,4 +3,7 @@ pub mod pod_watcher;
 pub mod event_server;
 pub mod watchdog;
 pub mod resource_state_updater;
-pub mod scheduling;
\ No newline at end of file
+pub mod scheduling;
+pub mod drain_assistant;
+pub mod plan_applier;
+pub mod shutdown;
\ No newline at end of file
@@ -0,0 +1,354 @@
+/*
+This file contains the component in charge
+of applying RTPlans: the desired state of all the
+RTResources listed in a plan is written as a whole,
+or not at all, so that a reconcile batch of the scaler
+never leaves the cluster half-updated.
+The desired states are first staged (the watchdogs do not act
+on staged RTResources) and then committed once all of them
+were written.
+The RTResources remain the per-service views the rest
+of the controller pipeline works on.
+*/
+
+use std::{
+    ptr,
+    ffi::c_void
+};
+use kube::{
+    Api,
+    Client,
+    api::{
+        Patch,
+        PatchParams
+    },
+    runtime::watcher::{
+        watcher,
+        Config,
+        Event
+    }
+};
+use futures::{
+    StreamExt,
+    stream::select_all
+};
+
+use crate::utils::vars::SharedState;
+use crate::utils::rtresource::RTResource;
+use crate::utils::rtplan::{
+    RTPlan,
+    PLAN_ANNOTATION,
+    PLAN_STAGED_ANNOTATION,
+    PLAN_APPLIED,
+    PLAN_FAILED,
+    staged_plan
+};
+
+
+
+/*
+Maximum number of attempts to apply a plan
+whose writes conflict with concurrent RTResource updates
+*/
+const PLAN_APPLY_ATTEMPTS: usize = 3;
+
+/*
+RTResource update prepared from a plan entry
+*/
+struct PlannedUpdate {
+    name: String,
+    namespace: String,
+    resource_version: Option<String>,
+    previous_replicas: Option<i32>,
+    replicas: i32,
+}
+
+/*
+Error returned when a plan cannot be applied,
+conflict is set when a write failed because
+the RTResource changed after it was read
+*/
+struct PlanError {
+    message: String,
+    conflict: bool,
+}
+
+impl PlanError {
+    fn new(message: String) -> Self {
+        PlanError {
+            message: message,
+            conflict: false,
+        }
+    }
+}
+
+/*
+This function stages the desired replicas of the RTResource:
+they are written together with the staged plan annotation, so that
+the watchdogs do not act on them until the plan is committed.
+The write fails when the RTResource changed after it was read.
+It returns the updated RTResource.
+*/
+async fn stage_replicas(client: Client, update: &PlannedUpdate, plan: &str) -> Result<RTResource, kube::Error> {
+    let rtresource_api: Api<RTResource> = Api::namespaced(client, &update.namespace);
+    let patch = serde_json::json!({
+        "metadata": {
+            "resourceVersion": update.resource_version,
+            "annotations": {
+                PLAN_ANNOTATION: plan,
+                PLAN_STAGED_ANNOTATION: plan
+            }
+        },
+        "spec": {
+            "replicas": update.replicas
+        }
+    });
+    rtresource_api.patch(&update.name, &PatchParams::default(), &Patch::Merge(&patch)).await
+}
+
+/*
+This function restores the replicas the RTResource had before
+the plan was staged and removes the staged plan annotation.
+If the RTResource had no replicas, the field is removed.
+The write fails when the RTResource changed after it was staged,
+so that later updates are not overwritten.
+*/
+async fn unstage_replicas(client: Client, update: &PlannedUpdate, resource_version: Option<&String>) -> Result<(), kube::Error> {
+    let rtresource_api: Api<RTResource> = Api::namespaced(client, &update.namespace);
+    let patch = serde_json::json!({
+        "metadata": {
+            "resourceVersion": resource_version,
+            "annotations": {
+                PLAN_STAGED_ANNOTATION: null
+            }
+        },
+        "spec": {
+            "replicas": update.previous_replicas
+        }
+    });
+    rtresource_api.patch(&update.name, &PatchParams::default(), &Patch::Merge(&patch)).await?;
+
+    Ok(())
+}
+
+/*
+This function commits the staged replicas of the RTResource
+by removing the staged plan annotation, so that the watchdogs
+reconcile it towards its new desired state.
+*/
+async fn commit_replicas(client: Client, update: &PlannedUpdate) -> Result<(), kube::Error> {
+    let rtresource_api: Api<RTResource> = Api::namespaced(client, &update.namespace);
+    let patch = serde_json::json!({
+        "metadata": {
+            "annotations": {
+                PLAN_STAGED_ANNOTATION: null
+            }
+        }
+    });
+    rtresource_api.patch(&update.name, &PatchParams::default(), &Patch::Merge(&patch)).await?;
+
+    Ok(())
+}
+
+/*
+This function applies the plan in two phases:
+    1. all the target RTResources are read and the updates prepared:
+       if any of them is missing, nothing is written;
+    2. the updates are staged, each one conditioned on the
+       RTResource version read in the first phase: if any write fails,
+       the updates already staged are rolled back (each rollback conditioned
+       on the version written by the plan, so that later updates are not lost);
+    3. the staged updates are committed.
+RTResources still staged by a previous attempt of the same plan
+(e.g. interrupted by a controller restart) are staged again,
+so that they are committed as well.
+Entries can only target RTResources in the namespace of the plan,
+so that the plan cannot be used to update RTResources its author
+has no access to.
+It returns the number of updated RTResources.
+*/
+async fn apply_plan(client: Client, plan: &RTPlan) -> Result<i32, PlanError> {
+    let plan_namespace = plan.metadata.namespace.clone().unwrap_or_default();
+    let plan_id = format!(
+        "{}/{}",
+        plan.metadata.name.clone().unwrap_or_default(),
+        plan.metadata.generation.unwrap_or(0)
+    );
+
+    let mut updates: Vec<PlannedUpdate> = Vec::new();
+    for entry in plan.spec.entries.iter() {
+        let namespace = entry.namespace.clone().unwrap_or(plan_namespace.clone());
+        if namespace != plan_namespace {
+            return Err(PlanError::new(format!(
+                "RTResource {} is in namespace {}, outside the namespace of the plan",
+                entry.name,
+                namespace
+            )));
+        }
+        let rtresource_api: Api<RTResource> = Api::namespaced(client.clone(), &namespace);
+        let rtresource = match rtresource_api.get_opt(&entry.name).await {
+            Ok(Some(r)) => r,
+            Ok(None) => return Err(PlanError::new(format!("RTResource {} not found in namespace {}", entry.name, namespace))),
+            Err(e) => return Err(PlanError::new(format!("error retrieving RTResource {}: {}", entry.name, e))),
+        };
+        if rtresource.spec.replicas == Some(entry.replicas) && staged_plan(&rtresource).is_none() {
+            continue;
+        }
+        updates.push(PlannedUpdate {
+            name: entry.name.clone(),
+            namespace: namespace,
+            resource_version: rtresource.metadata.resource_version.clone(),
+            previous_replicas: rtresource.spec.replicas,
+            replicas: entry.replicas,
+        });
+    }
+
+    let mut staged: Vec<Option<String>> = Vec::new();
+    for update in updates.iter() {
+        match stage_replicas(client.clone(), update, &plan_id).await {
+            Ok(r) => staged.push(r.metadata.resource_version),
+            Err(e) => {
+                for (applied, resource_version) in updates.iter().zip(staged.iter()) {
+                    if let Err(e) = unstage_replicas(client.clone(), applied, resource_version.as_ref()).await {
+                        eprintln!("Plan Applier - An error occurred while rolling back RTResource {}: {}", applied.name, e);
+                    }
+                }
+                return Err(PlanError {
+                    message: format!("error updating RTResource {}: {}", update.name, e),
+                    conflict: matches!(&e, kube::Error::Api(ae) if ae.code == 409),
+                });
+            }
+        }
+    }
+
+    for update in updates.iter() {
+        if let Err(e) = commit_replicas(client.clone(), update).await {
+            return Err(PlanError::new(format!("error committing RTResource {}: {}", update.name, e)));
+        }
+    }
+
+    Ok(updates.len() as i32)
+}
+
+/*
+This function reports the outcome of the plan in its status.
+*/
+async fn report_plan_outcome(client: Client, plan: &RTPlan, outcome: &Result<i32, String>) {
+    let plan_api: Api<RTPlan> = Api::namespaced(client, plan.metadata.namespace.as_ref().unwrap());
+    let status = match outcome {
+        Ok(applied) => serde_json::json!({
+            "observedGeneration": plan.metadata.generation,
+            "phase": PLAN_APPLIED,
+            "appliedEntries": applied,
+            "message": format!("{} RTResources updated", applied)
+        }),
+        Err(e) => serde_json::json!({
+            "observedGeneration": plan.metadata.generation,
+            "phase": PLAN_FAILED,
+            "appliedEntries": 0,
+            "message": e
+        }),
+    };
+    let patch = serde_json::json!({ "status": status });
+    if let Err(e) = plan_api.patch_status(
+        plan.metadata.name.as_ref().unwrap(),
+        &PatchParams::default(),
+        &Patch::Merge(&patch)
+    ).await {
+        eprintln!("Plan Applier - An error occurred while updating the status of RTPlan {}: {}", plan.metadata.name.as_ref().unwrap(), e);
+    }
+}
+
+/*
+This function applies the plan if its current
+generation was not processed yet.
+If the plan conflicts with concurrent RTResource updates,
+it is applied again (on the fresh RTResources) before
+its generation is reported as failed.
+*/
+async fn process_plan(client: Client, plan: &RTPlan) {
+    let generation = plan.metadata.generation.unwrap_or(0);
+    let observed_generation = plan.status.as_ref()
+        .and_then(|s| s.observed_generation)
+        .unwrap_or(0);
+    if generation == observed_generation {
+        return;
+    }
+
+    let mut outcome = apply_plan(client.clone(), plan).await;
+    let mut attempt = 1;
+    while let Err(e) = outcome.as_ref() {
+        if !e.conflict || attempt >= PLAN_APPLY_ATTEMPTS {
+            break;
+        }
+        println!(
+            "Plan Applier - RTPlan {} (generation {}) conflicted with a concurrent update, retrying...",
+            plan.metadata.name.as_ref().unwrap(),
+            generation
+        );
+        attempt = attempt + 1;
+        outcome = apply_plan(client.clone(), plan).await;
+    }
+    let outcome = outcome.map_err(|e| e.message);
+    match outcome.as_ref() {
+        Ok(applied) => println!(
+            "Plan Applier - RTPlan {} (generation {}) applied, {} RTResources updated",
+            plan.metadata.name.as_ref().unwrap(),
+            generation,
+            applied
+        ),
+        Err(e) => eprintln!(
+            "Plan Applier - RTPlan {} (generation {}) not applied: {}",
+            plan.metadata.name.as_ref().unwrap(),
+            generation,
+            e
+        ),
+    }
+    report_plan_outcome(client, plan, &outcome).await;
+}
+
+pub extern "C" fn plan_applier(thread_data: *mut c_void) -> *mut c_void {
+    unsafe {
+        let shared_state = &mut *(thread_data as *mut SharedState);
+
+        let client = shared_state.context.client.clone();
+
+        /*
+        We watch RTPlans (one watcher for each watched namespace,
+        merged in a single stream) and apply every new generation.
+        The RTResource updates are then handled by the
+        rest of the pipeline as any other spec change.
+        */
+        shared_state.runtime_handle.block_on(async {
+            let watcher_config = Config {
+                timeout: Some(100),
+                ..Config::default()
+            };
+            let mut watcher = select_all(
+                shared_state.context.rt_plans.iter().map(|api| {
+                    watcher(api.clone(), watcher_config.clone()).boxed()
+                })
+            );
+            while let Some(event) = watcher.next().await {
+                match event {
+                    Ok(Event::Applied(plan)) => {
+                        process_plan(client.clone(), &plan).await;
+                    }
+                    Ok(Event::Restarted(plans)) => {
+                        for plan in plans.iter() {
+                            process_plan(client.clone(), plan).await;
+                        }
+                    }
+                    Ok(Event::Deleted(_)) => {}
+                    Err(e) => {
+                        eprintln!("Plan Applier - {}", e);
+                    }
+                }
+            }
+        });
+
+        println!("Plan Applier - Something went wrong, RTPlans will no longer be applied! Restart the controller to recover!");
+    }
+
+    ptr::null_mut()
+}
@@ -26,10 +26,15 @@ use kube::runtime::watcher::{
         Config,
         Event
 };
-use futures::StreamExt;
+use futures::{
+    StreamExt,
+    stream::select_all
+};
 
 use crate::utils::vars::SharedState;
 use crate::utils::vars::QueueMessage;
+use crate::utils::rtresource::is_retained;
+use crate::utils::rtresource::DEBUG_CRITICALITY_LABEL;
 
 
 
@@ -47,6 +52,7 @@ pub extern "C" fn pod_watcher(thread_data: *mut c_void) -> *mut c_void {
 			name: "".to_string(),
 			uid: "".to_string(),
 			namespace: "".to_string(),
+			urgent: false,
 		};
         let mut queue_attr: mq_attr = { mem::zeroed() };
         queue_attr.mq_flags = 0;
@@ -65,32 +71,39 @@ pub extern "C" fn pod_watcher(thread_data: *mut c_void) -> *mut c_void {
         }
         
         /*
-		Now we can start the event watcher for RTResources related Pods.
+		Now we can start the event watcher for RTResources related Pods
+		(one for each watched namespace, merged in a single stream).
 		Each time an event is captured, we send a message to the
 		event priority queue with name, UID and namespace of the related
         RTResource. The message priority is set equal to the criticality
 		level of the resource.
         Note: we use the Pods label "criticality" to filter RTResource related Pods
-        and retrieve the application criticality level.
+        and retrieve the application criticality level (the debug replica carries
+        it in a dedicated label instead). Pods retained after the
+        deletion of their RTResource are ignored.
 		*/
         shared_state.runtime_handle.block_on(async {
             let watcher_config = Config {
                 timeout: Some(100),
                 ..Config::default()
             };
-            let mut watcher = watcher(
-                shared_state.context.pods.clone(),
-                watcher_config
-            ).boxed();
+            let mut watcher = select_all(
+                shared_state.context.pods.iter().map(|api| {
+                    watcher(api.clone(), watcher_config.clone()).boxed()
+                })
+            );
             while let Some(event) = watcher.next().await {
                 match event{
                     Ok(Event::Deleted(object)) => {
+                        if is_retained(&object) {
+                            continue;
+                        }
                         if let Some(labels) = &object.metadata.labels {
                             if let (Some(name), Some(uid), Some(namespace), Some(critcality_str)) = (
                                 labels.get("rtresource_name"),
                                 labels.get("rtresource_uid"),
                                 labels.get("rtresource_namespace"),
-                                labels.get("criticality")
+                                labels.get("criticality").or_else(|| labels.get(DEBUG_CRITICALITY_LABEL))
                             ) {
                                 if let Ok(criticality) = critcality_str.parse::<u32>() {
                                     msg.name = name.clone();
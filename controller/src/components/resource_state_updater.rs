@@ -5,13 +5,50 @@ the state  of managed Pods.
 */
 
 use std::{
+    mem,
     ptr,
-    ffi::c_void
+    process::exit,
+    os::raw::c_char,
+    ffi::c_void,
+    collections::HashSet,
+    time::Duration
+};
+use libc::{
+    mqd_t,
+    mq_open,
+    mq_send,
+    mq_close,
+    mq_attr,
+    O_CREAT,
+    O_WRONLY
+};
+use kube::{
+    Api,
+    api::{
+        Patch,
+        PatchParams
+    }
 };
-use kube::Api;
 
 use crate::utils::vars::SharedState;
+use crate::utils::vars::QueueMessage;
+use crate::utils::vars::URGENT_EVENT_PRIORITY;
+use crate::utils::scale_rate::take_expired_throttle;
+use crate::utils::resync::ResyncSchedule;
 use crate::utils::rtresource::RTResource;
+use crate::utils::rtresource::is_rt_configured;
+use crate::utils::rtresource::is_debug;
+use crate::utils::rtresource::scale_up_admitted_for_ms;
+use crate::utils::rtresource::{
+    PENDING_INTENT_ANNOTATION,
+    pending_intent
+};
+use crate::utils::conditions::{
+    is_progressing,
+    is_ready,
+    mark_ready,
+    mark_capacity_pending
+};
 
 
 
@@ -20,23 +57,122 @@ pub extern "C" fn resource_state_updater(thread_data: *mut c_void) -> *mut c_voi
     unsafe {
         let shared_state = &mut *(thread_data as *mut SharedState);
 
+        /*
+        We must first open the message queue
+        in case it is not already opened.
+        We open it in write-only mode, since this thread
+        only requeues RTResources whose scaling was throttled
+        by their scale velocity limits.
+        */
+        let mut queue_attr: mq_attr = { mem::zeroed() };
+        queue_attr.mq_flags = 0;
+        queue_attr.mq_maxmsg = 2000;
+        queue_attr.mq_msgsize = 256;
+        queue_attr.mq_curmsgs = 0;
+        let queue_des: mqd_t = mq_open(
+            shared_state.queue.as_ptr() as *const c_char,
+            O_CREAT | O_WRONLY,
+            0664,
+            &queue_attr
+        );
+        if queue_des == -1 {
+            eprintln!("State Updater - An error occurred while opening the queue!");
+            exit(-1);
+        }
+
+        let rt_readiness_gate = shared_state.config.rt_readiness_gate;
+        let mut resync_schedule = ResyncSchedule::new(
+            Duration::from_secs(shared_state.config.resync_period),
+            Duration::from_secs(shared_state.config.resync_jitter)
+        );
+
         shared_state.runtime_handle.block_on(async {
             let mut error_count: usize = 0;
             let lp = kube::api::ListParams::default();
             'outer: loop {
-                match shared_state.context.rt_resources.list(&lp).await {
+                match shared_state.context.list_rtresources(&lp).await {
                     /*
                     We must first obtain a list of all RTResources
                     currently managed by the controller and, thus, deployed in the cluster.
                     We sort them by criticality to process the most critical ones first.
                     */
                     Ok(list) => {
-                        let mut items = list.items;
+                        let mut items = list;
                         items.sort_by_key(|r| r.spec.criticality);
+                        let uids: HashSet<String> = items.iter()
+                            .filter_map(|r| r.metadata.uid.clone())
+                            .collect();
+                        resync_schedule.retain(&uids);
                         for r in items {
-                            if let Some(conditions) = r.status.as_ref().and_then(|s| s.conditions.as_ref()) {
-                                let is_progressing = conditions.iter().any(|c| c.condition_type == "Progressing" && c.status == "True");
-                                if is_progressing {
+                            /*
+                            If the scaling of the RTResource was throttled by its
+                            scale velocity limits and the scale window expired,
+                            we requeue it so that a watchdog completes the scaling.
+                            The same happens when its periodic resync is due
+                            (if enabled), so that any drift is corrected, and when
+                            a previous controller instance left an event pending on it
+                            at shutdown (the pending intent is cleared first, so that
+                            it is requeued only once).
+                            */
+                            if let (Some(name), Some(uid), Some(namespace)) = (
+                                r.metadata.name.as_ref(),
+                                r.metadata.uid.as_ref(),
+                                r.metadata.namespace.as_ref()
+                            ) {
+                                let throttled = take_expired_throttle(thread_data as *mut SharedState, uid);
+                                let resync = resync_schedule.is_due(uid);
+                                let mut pending = false;
+                                let mut urgent = false;
+                                if let Some(pending_urgent) = pending_intent(&r) {
+                                    let patch = serde_json::json!({
+                                        "metadata": {
+                                            "annotations": {
+                                                PENDING_INTENT_ANNOTATION: null
+                                            }
+                                        }
+                                    });
+                                    let rtresource_namespaced_api = Api::<RTResource>::namespaced(
+                                        shared_state.context.client.clone(),
+                                        namespace
+                                    );
+                                    match rtresource_namespaced_api.patch(name, &PatchParams::default(), &Patch::Merge(&patch)).await {
+                                        Ok(_) => {
+                                            pending = true;
+                                            urgent = pending_urgent;
+                                        }
+                                        Err(e) => eprintln!("State Updater - An error occurred while clearing the pending intent of RTResource {}: {}", uid, e),
+                                    }
+                                }
+                                if throttled || resync || pending {
+                                    let msg = QueueMessage {
+                                        name: name.clone(),
+                                        uid: uid.clone(),
+                                        namespace: namespace.clone(),
+                                        urgent: urgent,
+                                    };
+                                    println!(
+                                        "State Updater - Requeuing {} RTResource {}, {} in namespace {}",
+                                        if pending { "pending" } else if throttled { "throttled" } else { "resynced" },
+                                        name,
+                                        uid,
+                                        namespace
+                                    );
+                                    let mut c_msg = msg.into_bytes();
+                                    c_msg.push(0);
+                                    let result = mq_send(
+                                        queue_des,
+                                        c_msg.as_ptr() as *const i8,
+                                        c_msg.len(),
+                                        if urgent { URGENT_EVENT_PRIORITY } else { r.spec.criticality }
+                                    );
+                                    if result == -1 {
+                                        eprintln!("State Updater - An error occurred while sending a message to the queue!");
+                                    }
+                                }
+                            }
+
+                            if let Some(status) = r.status.as_ref() {
+                                if is_progressing(status) {
                                     let uid = r.metadata.uid.as_ref().unwrap();
                                     let desired_replicas = r.status.as_ref().and_then(|s| s.desired_replicas).unwrap_or(0);
 
@@ -46,8 +182,8 @@ pub extern "C" fn resource_state_updater(thread_data: *mut c_void) -> *mut c_voi
                                     */
                                     let pod_lp = kube::api::ListParams::default()
                                         .labels(&format!("rtresource_uid={}", uid));
-                                    let pods = match shared_state.context.pods.list(&pod_lp).await {
-                                        Ok(pod_list) => pod_list.items,
+                                    let pods = match shared_state.context.list_pods(&pod_lp).await {
+                                        Ok(pod_list) => pod_list,
                                         Err(e) => {
                                             eprintln!("State Updater - Error listing pods for RTResource {}: {}", uid, e);
                                             continue;
@@ -56,10 +192,14 @@ pub extern "C" fn resource_state_updater(thread_data: *mut c_void) -> *mut c_voi
 
                                     /*
                                     2. We count the number of pods in Running state.
+                                    If the RT readiness gate is enabled, a pod is only counted
+                                    once the RT scheduling parameters have been applied to it.
+                                    The debug replica (if any) is never counted.
                                     */
-                                    let running_count = pods.iter().filter(|p| {
+                                    let running_count = pods.iter().filter(|p| !is_debug(p)).filter(|p| {
                                         if let Some(status) = &p.status {
                                             status.phase.as_deref() == Some("Running")
+                                                && (!rt_readiness_gate || is_rt_configured(p))
                                         } else {
                                             false
                                         }
@@ -67,45 +207,48 @@ pub extern "C" fn resource_state_updater(thread_data: *mut c_void) -> *mut c_voi
 
                                     /*
                                     3. Check if the pod running count has changed compared to
-                                    the current status. Only proceed with a status update if
-                                    there's an actual change.
+                                    the current status, or if the desired replicas are all running
+                                    but the RTResource is not marked as ready yet.
+                                    Only proceed with a status update if there's an actual change.
                                     */
                                     let current_replicas = r.status.as_ref().and_then(|s| s.replicas).unwrap_or(-1);
                                     
-                                    if current_replicas != running_count {
+                                    if current_replicas != running_count || (running_count == desired_replicas && !is_ready(status)) {
                                         /*
                                         4. We update the RTResource status with the
                                         current number of running replicas and update
                                         the conditions accordingly.
                                         If the number of running replicas matches the desired one,
-                                        we set the "Progressing" to 'False' and "Ready" to 'True',
-                                        then we update running replicas status field.
-                                        Otherwise, we only update the replicas count.
+                                        we mark the RTResource as ready ("Progressing" = 'False'
+                                        and "Ready" = 'True'), otherwise we mark it as still
+                                        waiting for capacity.
                                         */
                                         let mut new_status = r.status.clone().unwrap_or_default();
                                         
                                         new_status.replicas = Some(running_count);
 
-                                        let mut new_conditions = new_status.conditions.unwrap_or_default();
-                                        let transition_time = chrono::Utc::now().to_rfc3339();
-                                        if running_count == desired_replicas {
-                                            for cond in &mut new_conditions {
-                                                if cond.condition_type == "Progressing" {
-                                                    cond.status = "False".to_string();
-                                                    cond.reason = Some("All desired replicas are running!".to_string());
-                                                    cond.message = Some("All desired replicas are running!".to_string());
-                                                    cond.last_transition_time = Some(transition_time.clone());
-                                                }
-                                                if cond.condition_type == "Ready" {
-                                                    cond.status = "True".to_string();
-                                                    cond.reason = Some("All desired replicas are running!".to_string());
-                                                    cond.message = Some("All desired replicas are running!".to_string());
-                                                    cond.last_transition_time = Some(transition_time.clone());
-                                                }
+                                        /*
+                                        If the RTResource had no running replica and the first
+                                        one just came up, we record its cold-start latency: the
+                                        time elapsed from the admission of the scale up from zero
+                                        to the first running replica.
+                                        */
+                                        if current_replicas <= 0 && running_count > 0 {
+                                            if let Some(latency) = scale_up_admitted_for_ms(status) {
+                                                new_status.cold_start_latency_ms = Some(latency);
+                                                new_status.scale_up_admitted_at = None;
+                                                println!("State Updater - Cold start of RTResource {} took {}ms", uid, latency);
                                             }
                                         }
 
-                                        new_status.conditions = Some(new_conditions);
+                                        if running_count == desired_replicas {
+                                            mark_ready(&mut new_status, "All desired replicas are running");
+                                        } else {
+                                            mark_capacity_pending(
+                                                &mut new_status,
+                                                &format!("{} out of {} desired replicas are running", running_count, desired_replicas)
+                                            );
+                                        }
 
                                         /*
                                         5. We push the status update to the Kubernetes API
@@ -147,6 +290,11 @@ pub extern "C" fn resource_state_updater(thread_data: *mut c_void) -> *mut c_voi
         });
         
         println!("State Updater - Something went wrong, no new RTResource updates will be processed! Restart the controller to recover!");
+
+        /*
+        Cleanup phase.
+        */
+        mq_close(queue_des);
     }
 
     ptr::null_mut()
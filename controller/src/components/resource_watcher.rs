@@ -26,10 +26,15 @@ use kube::runtime::watcher::{
     Config,
     Event
 };
-use futures::StreamExt;
+use futures::{
+	StreamExt,
+	stream::select_all
+};
 
 use crate::utils::vars::SharedState;
 use crate::utils::vars::QueueMessage;
+use crate::utils::vars::URGENT_EVENT_PRIORITY;
+use crate::utils::rtresource::is_urgent;
 
 
 
@@ -47,6 +52,7 @@ pub extern "C" fn crd_watcher(thread_data: *mut c_void) -> *mut c_void {
 			name: "".to_string(),
 			uid: "".to_string(),
 			namespace: "".to_string(),
+			urgent: false,
 		};
     	let mut queue_attr: mq_attr = { mem::zeroed() };
 		queue_attr.mq_flags = 0;
@@ -65,23 +71,29 @@ pub extern "C" fn crd_watcher(thread_data: *mut c_void) -> *mut c_void {
 		}
 		
 		/*
-		Now we can start the event watcher for RTResources.
+		Now we can start the event watcher for RTResources
+		(one for each watched namespace, merged in a single stream).
 		Each time an event is captured, we send a message to the
 		event priority queue with name, UID and namespace of
 		the involved RTResource. The message priority is set equal
-		to the criticality level of the resource.
+		to the criticality level of the resource, unless the update
+		was marked as urgent: in that case the message is sent with
+		the urgent priority so that it is handled before any other event.
 		If the event is an addition or a modification, we only
-		filter for spec modifications.
+		filter for spec modifications and for RTResources being deleted
+		(whose deletion policy must be enforced before the controller
+		finalizer is removed).
 		*/
 		shared_state.runtime_handle.block_on(async {
 			let watcher_config = Config {
 				timeout: Some(100),
 				..Config::default()
 			};
-			let mut watcher = watcher(
-				shared_state.context.rt_resources.clone(),
-				watcher_config
-			).boxed();
+			let mut watcher = select_all(
+				shared_state.context.rt_resources.iter().map(|api| {
+					watcher(api.clone(), watcher_config.clone()).boxed()
+				})
+			);
 			while let Some(event) = watcher.next().await {
 				match event{
 					Ok(Event::Applied(object)) => {
@@ -94,24 +106,32 @@ pub extern "C" fn crd_watcher(thread_data: *mut c_void) -> *mut c_void {
 							let observed_generation = object.status.as_ref()
 								.and_then(|s| s.observed_generation)
 								.unwrap_or(0);
-							if generation != observed_generation {
+							let being_deleted = object.metadata.deletion_timestamp.is_some();
+							if generation != observed_generation || being_deleted {
 								msg.name = name.clone();
 								msg.uid = uid.clone();
 								msg.namespace = namespace.clone();
+								msg.urgent = is_urgent(&object);
 								println!(
-									"CRD Watcher - Detected event for RTResource {}, {} in namespace {} with criticality {}",
+									"CRD Watcher - Detected event for RTResource {}, {} in namespace {} with criticality {} (urgent: {})",
 									msg.name,
 									msg.uid,
 									msg.namespace,
-									object.spec.criticality
+									object.spec.criticality,
+									msg.urgent
 								);
+								let priority = if msg.urgent {
+									URGENT_EVENT_PRIORITY
+								} else {
+									object.spec.criticality
+								};
 								let mut c_msg = msg.clone().into_bytes();
 								c_msg.push(0);
 								let result = mq_send(
 									queue_des,
 									c_msg.as_ptr() as *const i8,
 									c_msg.len(),
-									object.spec.criticality
+									priority
 								);
 								if result == -1 {
 									eprintln!("CRD Watcher - An error occurred while sending a message to the queue!");
@@ -131,6 +151,7 @@ pub extern "C" fn crd_watcher(thread_data: *mut c_void) -> *mut c_void {
 							msg.name = name.clone();
 							msg.uid = uid.clone();
 							msg.namespace = namespace.clone();
+							msg.urgent = false;
 							println!(
 								"CRD Watcher - Detected deletion of RTResource {}, {} in namespace {} with criticality {}",
 								msg.name,
@@ -16,20 +16,52 @@ use kube::{
     Api,
     api::{
         PostParams,
-        DeleteParams
+        DeleteParams,
+        Patch,
+        PatchParams
     }
 };
-use k8s_openapi::api::core::v1::Pod;
+use k8s_openapi::api::core::v1::{
+    Pod,
+    PodReadinessGate
+};
 // use rand::Rng; // For the random scheduler (currently not used)
 
 use crate::utils::rtresource::RTResource;
+use crate::utils::rtresource::RETAINED_ANNOTATION;
+use crate::utils::rtresource::RT_READINESS_GATE;
+use crate::utils::rtresource::DEBUG_LABEL;
+use crate::utils::rtresource::DEBUG_CRITICALITY_LABEL;
+use crate::utils::configuration::ControllerConfig;
+use crate::utils::profiles::{
+    find_resource_profile,
+    apply_resource_profile
+};
+
 
 
+/*
+This function checks that the Pods of the RTResource
+can be managed by the controller, i.e. that (when the controller
+is namespace-scoped) they are deployed in a watched namespace.
+*/
+fn check_pod_namespace(rtresource: &RTResource, config: &ControllerConfig) -> Result<(), Box<dyn Error>> {
+    if !config.watch_namespaces.is_empty() && !config.watch_namespaces.contains(&rtresource.spec.namespace) {
+        return Err(format!(
+            "The Pods of RTResource {} cannot be deployed in namespace {}, which is not watched by the controller!",
+            rtresource.metadata.name.clone().unwrap_or_default(),
+            rtresource.spec.namespace
+        ).into());
+    }
+
+    Ok(())
+}
 
 /*
-This function creates a Pod in the cluster.
+This function builds a managed Pod
+from the RTResource template.
 */
-pub async fn create_pod(thread_name: String, client: Client, rtresource: &RTResource) -> Result<(), Box<dyn Error>> {
+fn build_pod(rtresource: &RTResource, config: &ControllerConfig) -> Pod {
     /*
     We must create the Pod metadata:
     - name = rtresource_name-timestamp
@@ -87,16 +119,31 @@ pub async fn create_pod(thread_name: String, client: Client, rtresource: &RTReso
         rtresource.spec.criticality.to_string(),
     );
 
-    let pod_spec = rtresource.spec.template.spec.clone();
-
     /*
-    Now we can create the Pod object
-    and submit it to the cluster.
     The Pod spec is as is in the RTResource spec.template.
     */
-    let pod_api: Api<Pod> = Api::namespaced(client.clone(), &pod_namespace);
+    let mut pod_spec = rtresource.spec.template.spec.clone();
+
+    /*
+    If enabled, we inject the RT readiness gate, so that the Pod is
+    not considered ready (and does not receive traffic) until the node
+    agent has applied its RT scheduling parameters.
+    */
+    if config.rt_readiness_gate {
+        if let Some(spec) = pod_spec.as_mut() {
+            let gates = spec.readiness_gates.get_or_insert_with(Vec::new);
+            if !gates.iter().any(|g| g.condition_type == RT_READINESS_GATE) {
+                gates.push(PodReadinessGate {
+                    condition_type: RT_READINESS_GATE.to_string(),
+                });
+            }
+        }
+    }
 
-    let pod = Pod {
+    /*
+    Now we can create the Pod object.
+    */
+    Pod {
         metadata: kube::core::ObjectMeta {
             name: Some(pod_name.clone()),
             namespace: Some(pod_namespace.clone()),
@@ -106,17 +153,91 @@ pub async fn create_pod(thread_name: String, client: Client, rtresource: &RTReso
         },
         spec: pod_spec,
         ..Default::default()
-    };
+    }
+}
+
+/*
+This function submits the Pod to the cluster
+and returns its name if the creation succeeded.
+*/
+async fn submit_pod(thread_name: String, client: Client, pod: Pod) -> Result<Option<String>, Box<dyn Error>> {
+    let pod_api: Api<Pod> = Api::namespaced(client.clone(), pod.metadata.namespace.as_ref().unwrap());
 
     // let scheduled_pod = scheduler(thread_name.clone(), pod);
 
     let pp = PostParams::default();
     match pod_api.create(&pp, &pod).await { // Use scheduled_pod when scheduler function is used
-        Ok(o) => println!("{} - Pod created: {}!", thread_name, o.metadata.name.as_ref().unwrap()),
-        Err(e) => println!("{} - An error occurred while creating the Pod: {}!", thread_name, e),
+        Ok(o) => {
+            println!("{} - Pod created: {}!", thread_name, o.metadata.name.as_ref().unwrap());
+            Ok(o.metadata.name)
+        }
+        Err(e) => {
+            println!("{} - An error occurred while creating the Pod: {}!", thread_name, e);
+            Ok(None)
+        }
     }
+}
 
-    Ok(())
+/*
+This function creates a Pod in the cluster
+and returns its name if the creation succeeded.
+*/
+pub async fn create_pod(
+    thread_name: String,
+    client: Client,
+    rtresource: &RTResource,
+    config: &ControllerConfig
+) -> Result<Option<String>, Box<dyn Error>> {
+    check_pod_namespace(rtresource, config)?;
+    let mut pod = build_pod(rtresource, config);
+
+    /*
+    Containers without resource requests and limits get the
+    defaults of the resource profile matching the RTResource criticality
+    (if any), so that under-specified applications still get meaningful
+    reservations.
+    */
+    if let (Some(spec), Some(profile)) = (
+        pod.spec.as_mut(),
+        find_resource_profile(&config.resource_profiles, rtresource.spec.criticality)
+    ) {
+        apply_resource_profile(spec, profile);
+    }
+    submit_pod(thread_name, client, pod).await
+}
+
+/*
+This function creates the debug replica of the RTResource
+and returns its name if the creation succeeded.
+The debug replica runs the RTResource template but is exempt
+from RT guarantees: it carries no criticality (so no RT
+scheduling parameters are applied to it), no RT readiness gate,
+no priority class and no resource profile defaults, hence it never
+displaces guaranteed capacity.
+*/
+pub async fn create_debug_pod(
+    thread_name: String,
+    client: Client,
+    rtresource: &RTResource,
+    config: &ControllerConfig
+) -> Result<Option<String>, Box<dyn Error>> {
+    check_pod_namespace(rtresource, config)?;
+    let mut pod = build_pod(rtresource, config);
+    pod.metadata.name = Some(format!("{}-debug", pod.metadata.name.clone().unwrap_or_default()));
+    if let Some(labels) = pod.metadata.labels.as_mut() {
+        if let Some(criticality) = labels.remove("criticality") {
+            labels.insert(DEBUG_CRITICALITY_LABEL.to_string(), criticality);
+        }
+        labels.insert(DEBUG_LABEL.to_string(), "true".to_string());
+    }
+    if let Some(spec) = pod.spec.as_mut() {
+        spec.priority_class_name = None;
+        spec.priority = None;
+        if let Some(gates) = spec.readiness_gates.as_mut() {
+            gates.retain(|g| g.condition_type != RT_READINESS_GATE);
+        }
+    }
+    submit_pod(thread_name, client, pod).await
 }
 
 /*
@@ -133,6 +254,57 @@ pub async fn delete_pod(thread_name: String, client: Client, pod: Pod) -> Result
     Ok(())
 }
 
+/*
+This function marks a Pod as retained after the
+deletion of its RTResource (Retain deletion policy).
+The Pod keeps running and the controller no longer acts on it.
+*/
+pub async fn retain_pod(thread_name: String, client: Client, pod: Pod) -> Result<(), Box<dyn Error>> {
+
+    let pod_name = pod.metadata.name.as_ref().unwrap();
+    let pod_namespace = pod.metadata.namespace.as_ref().unwrap();
+    let pod_api: Api<Pod> = Api::namespaced(client.clone(), pod_namespace);
+    let patch = serde_json::json!({
+        "metadata": {
+            "annotations": {
+                RETAINED_ANNOTATION: "true"
+            }
+        }
+    });
+    pod_api.patch(pod_name, &PatchParams::default(), &Patch::Merge(&patch)).await?;
+    println!("{} - Pod {} retained in namespace {}!", thread_name, pod_name, pod_namespace);
+
+    Ok(())
+}
+
+/*
+This function detaches a Pod from its RTResource by removing
+the controller labels, debug ones included (Orphan deletion policy).
+The Pod keeps running as a standalone Pod.
+*/
+pub async fn orphan_pod(thread_name: String, client: Client, pod: Pod) -> Result<(), Box<dyn Error>> {
+
+    let pod_name = pod.metadata.name.as_ref().unwrap();
+    let pod_namespace = pod.metadata.namespace.as_ref().unwrap();
+    let pod_api: Api<Pod> = Api::namespaced(client.clone(), pod_namespace);
+    let patch = serde_json::json!({
+        "metadata": {
+            "labels": {
+                "rtresource_name": null,
+                "rtresource_uid": null,
+                "rtresource_namespace": null,
+                "criticality": null,
+                DEBUG_LABEL: null,
+                DEBUG_CRITICALITY_LABEL: null
+            }
+        }
+    });
+    pod_api.patch(pod_name, &PatchParams::default(), &Patch::Merge(&patch)).await?;
+    println!("{} - Pod {} orphaned in namespace {}!", thread_name, pod_name, pod_namespace);
+
+    Ok(())
+}
+
 /*
 This function schedules a Pod on a node.
 
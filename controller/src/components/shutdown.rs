@@ -0,0 +1,256 @@
+/*
+This file contains the component in charge
+of the graceful shutdown of the controller: on SIGTERM,
+pending events are given a bounded time to be handled,
+and those still pending are persisted on the RTResources
+so that the next controller instance picks them up.
+*/
+
+use std::{
+    mem,
+    ptr,
+    process::exit,
+    os::raw::c_char,
+    ffi::c_void,
+    collections::HashMap,
+    time::{
+        Duration,
+        Instant
+    }
+};
+use libc::{
+    mqd_t,
+    mq_open,
+    mq_receive,
+    mq_getattr,
+    mq_close,
+    mq_attr,
+    O_CREAT,
+    O_RDONLY,
+    O_NONBLOCK,
+    pthread_mutex_lock,
+    pthread_mutex_unlock
+};
+use kube::{
+    Api,
+    api::{
+        ListParams,
+        Patch,
+        PatchParams
+    }
+};
+use tokio::signal::unix::{
+    signal,
+    SignalKind
+};
+
+use crate::utils::vars::SharedState;
+use crate::utils::vars::QueueMessage;
+use crate::utils::rtresource::{
+    RTResource,
+    PENDING_INTENT_ANNOTATION
+};
+use crate::utils::scale_rate::throttled_uids;
+
+
+
+/*
+This function checks whether the event queue is empty
+and no watchdog is handling an event.
+*/
+fn is_idle(shared_state: *mut SharedState, queue_des: mqd_t) -> bool {
+    unsafe {
+        let shared_state = &mut *shared_state;
+        let mut queue_attr: mq_attr = mem::zeroed();
+        if mq_getattr(queue_des, &mut queue_attr) == -1 {
+            return false;
+        }
+        pthread_mutex_lock(&mut shared_state.mutex);
+        let working = shared_state.working_threads;
+        pthread_mutex_unlock(&mut shared_state.mutex);
+
+        queue_attr.mq_curmsgs == 0 && working == 0
+    }
+}
+
+/*
+This function adds an event to the pending ones, indexed by
+RTResource UID (an RTResource is urgent if any of its events is).
+*/
+fn add_pending(pending: &mut HashMap<String, QueueMessage>, msg: QueueMessage) {
+    let urgent = msg.urgent || pending.get(&msg.uid).map(|m| m.urgent).unwrap_or(false);
+    let uid = msg.uid.clone();
+    pending.insert(uid, QueueMessage { urgent: urgent, ..msg });
+}
+
+/*
+This function stops the watchdogs from handling new events:
+the events they retrieve from now on are only recorded in flight.
+*/
+fn stop_watchdogs(shared_state: *mut SharedState) {
+    unsafe {
+        let shared_state = &mut *shared_state;
+        pthread_mutex_lock(&mut shared_state.mutex);
+        shared_state.shutting_down = true;
+        pthread_mutex_unlock(&mut shared_state.mutex);
+    }
+}
+
+/*
+This function returns the events recorded in flight by the watchdogs.
+*/
+fn in_flight_events(shared_state: *mut SharedState) -> Vec<QueueMessage> {
+    unsafe {
+        let shared_state = &mut *shared_state;
+        pthread_mutex_lock(&mut shared_state.mutex);
+        let in_flight = shared_state.in_flight.clone();
+        pthread_mutex_unlock(&mut shared_state.mutex);
+
+        in_flight
+    }
+}
+
+/*
+This function removes all the events still in the queue
+and adds them to the pending ones.
+*/
+fn drain_queue(queue_des: mqd_t, pending: &mut HashMap<String, QueueMessage>) {
+    loop {
+        let mut msg: [u8; 1024] = [0; 1024];
+        let mut priority: u32 = 0;
+        let result = unsafe {
+            mq_receive(
+                queue_des,
+                msg.as_mut_ptr() as *mut c_char,
+                msg.len(),
+                &mut priority as *mut u32
+            )
+        };
+        if result == -1 {
+            break;
+        }
+        match QueueMessage::from_bytes(&msg[..result as usize]) {
+            Ok(data) => add_pending(pending, data),
+            Err(e) => {
+                eprintln!("Shutdown - An error occurred while deserializing the message from the queue: {}", e);
+            }
+        }
+    }
+}
+
+pub extern "C" fn shutdown_handler(thread_data: *mut c_void) -> *mut c_void {
+    unsafe {
+        let shared_state = &mut *(thread_data as *mut SharedState);
+
+        /*
+        We open the event queue in non-blocking read-only mode
+        (in case it is not already opened), so that pending
+        events can be drained without waiting.
+        */
+        let mut queue_attr: mq_attr = { mem::zeroed() };
+        queue_attr.mq_flags = 0;
+        queue_attr.mq_maxmsg = 2000;
+        queue_attr.mq_msgsize = 256;
+        queue_attr.mq_curmsgs = 0;
+        let queue_des: mqd_t = mq_open(
+            shared_state.queue.as_ptr() as *const c_char,
+            O_CREAT | O_RDONLY | O_NONBLOCK,
+            0664,
+            &queue_attr
+        );
+        if queue_des == -1 {
+            eprintln!("Shutdown - An error occurred while opening the queue!");
+            return ptr::null_mut();
+        }
+
+        let context = shared_state.context.clone();
+        let timeout = Duration::from_secs(shared_state.config.shutdown_timeout);
+
+        let terminated = shared_state.runtime_handle.block_on(async {
+            let mut sigterm = match signal(SignalKind::terminate()) {
+                Ok(s) => s,
+                Err(e) => {
+                    eprintln!("Shutdown - An error occurred while installing the SIGTERM handler: {}", e);
+                    return false;
+                }
+            };
+            sigterm.recv().await;
+
+            /*
+            1. The watchdogs keep handling the queued events
+               until the queue is empty or the timeout expires.
+            */
+            println!("Shutdown - SIGTERM received, waiting up to {}s for pending events...", timeout.as_secs());
+            let deadline = Instant::now() + timeout;
+            while Instant::now() < deadline && !is_idle(thread_data as *mut SharedState, queue_des) {
+                tokio::time::sleep(Duration::from_millis(100)).await;
+            }
+
+            /*
+            2. The watchdogs are stopped: the events still queued or in flight
+               (including those retrieved by a watchdog while the queue is drained),
+               together with the RTResources whose scaling is throttled,
+               are persisted as pending intents on the RTResources themselves.
+               The in flight events are collected shortly after the queue is drained,
+               so that watchdogs that retrieved an event just before can record it.
+               The watchers keep enqueueing events meanwhile, so the queue
+               is drained a second time right before persisting.
+            */
+            let mut pending: HashMap<String, QueueMessage> = HashMap::new();
+            stop_watchdogs(thread_data as *mut SharedState);
+            drain_queue(queue_des, &mut pending);
+            tokio::time::sleep(Duration::from_millis(100)).await;
+            for msg in in_flight_events(thread_data as *mut SharedState) {
+                add_pending(&mut pending, msg);
+            }
+            let throttled = throttled_uids(thread_data as *mut SharedState);
+            if !throttled.is_empty() {
+                match context.list_rtresources(&ListParams::default()).await {
+                    Ok(list) => {
+                        for r in list.iter() {
+                            let uid = r.metadata.uid.clone().unwrap_or_default();
+                            if throttled.contains(&uid) && !pending.contains_key(&uid) {
+                                pending.insert(uid.clone(), QueueMessage {
+                                    name: r.metadata.name.clone().unwrap_or_default(),
+                                    uid: uid,
+                                    namespace: r.metadata.namespace.clone().unwrap_or_default(),
+                                    urgent: false,
+                                });
+                            }
+                        }
+                    }
+                    Err(e) => {
+                        eprintln!("Shutdown - An error occurred while listing RTResources: {}", e);
+                    }
+                }
+            }
+            drain_queue(queue_des, &mut pending);
+            for msg in pending.values() {
+                let rtresource_api: Api<RTResource> = Api::namespaced(context.client.clone(), &msg.namespace);
+                let intent = if msg.urgent { "urgent" } else { "normal" };
+                let patch = serde_json::json!({
+                    "metadata": {
+                        "annotations": {
+                            PENDING_INTENT_ANNOTATION: intent
+                        }
+                    }
+                });
+                match rtresource_api.patch(&msg.name, &PatchParams::default(), &Patch::Merge(&patch)).await {
+                    Ok(_) => println!("Shutdown - Persisted pending intent for RTResource {}, {} in namespace {}", msg.name, msg.uid, msg.namespace),
+                    Err(e) => eprintln!("Shutdown - An error occurred while persisting the pending intent of RTResource {}: {}", msg.uid, e),
+                }
+            }
+
+            true
+        });
+
+        mq_close(queue_des);
+        if terminated {
+            println!("Shutdown - Exiting...");
+            exit(0);
+        }
+        println!("Shutdown - Pending events will not be preserved on shutdown!");
+    }
+
+    ptr::null_mut()
+}
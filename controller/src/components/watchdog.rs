@@ -9,7 +9,8 @@ use std::{
     ptr,
     process::exit,
     os::raw::c_char,
-    ffi::c_void
+    ffi::c_void,
+    collections::HashSet
 };
 use libc::{
     sched_param,
@@ -27,17 +28,73 @@ use libc::{
     pthread_mutex_lock,
     pthread_mutex_unlock
 };
-use kube::Api;
+use kube::{
+    Api,
+    api::{
+        Patch,
+        PatchParams
+    }
+};
+use k8s_openapi::api::core::v1::Pod;
 
 use crate::utils::vars::SharedState;
 use crate::utils::vars::QueueMessage;
+use crate::utils::vars::URGENT_WATCHDOG_PRIORITY;
 use crate::utils::rtresource::RTResource;
-use crate::utils::rtresource::Condition;
+use crate::utils::rtresource::URGENT_ANNOTATION;
+use crate::utils::rtresource::DRAIN_REPLACEMENT_ANNOTATION;
+use crate::utils::rtplan::staged_plan;
+use crate::utils::rtresource::DeletionPolicy;
+use crate::utils::rtresource::is_retained;
+use crate::utils::rtresource::is_busy;
+use crate::utils::rtresource::is_debug;
+use crate::utils::decisions::{
+    Decision,
+    record_decision
+};
+use crate::utils::finalizer::{
+    has_finalizer,
+    add_finalizer,
+    remove_finalizer
+};
+use crate::utils::conditions::mark_admitted;
+use crate::utils::scale_rate::{
+    ScaleDirection,
+    reserve_scale,
+    defer_scale,
+    forget_scale_window
+};
 
 use crate::components::scheduling::create_pod;
+use crate::components::scheduling::create_debug_pod;
 use crate::components::scheduling::delete_pod;
+use crate::components::scheduling::retain_pod;
+use crate::components::scheduling::orphan_pod;
+use crate::components::drain_assistant::is_cordoned;
+
 
 
+/*
+This function returns the name of the Pod created
+to replace the given one while draining its node, if any.
+*/
+fn drain_replacement(pod: &Pod) -> Option<&String> {
+    pod.metadata.annotations
+        .as_ref()
+        .and_then(|a| a.get(DRAIN_REPLACEMENT_ANNOTATION))
+}
+
+/*
+This function checks whether the Pod runs on a cordoned node,
+so that it is preferred as a scale down candidate.
+*/
+fn is_on_cordoned_node(pod: &Pod, cordoned_nodes: &HashSet<String>) -> bool {
+    pod.spec
+        .as_ref()
+        .and_then(|s| s.node_name.as_ref())
+        .map(|n| cordoned_nodes.contains(n))
+        .unwrap_or(false)
+}
 
 pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
     unsafe {
@@ -117,8 +174,20 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
             The event server must be aware theat the watchdog
             is now working on an event, so that it can decide
             whether to spawn new watchdogs or not.
+            The event is also recorded as in flight, so that it can be
+            persisted if the controller shuts down before it is handled:
+            once the shutdown started, events are only recorded.
             */
             pthread_mutex_lock(&mut shared_state.mutex);
+            shared_state.in_flight.push(rtresource_data.clone());
+            if shared_state.shutting_down {
+                pthread_mutex_unlock(&mut shared_state.mutex);
+                println!(
+                    "Watchdog - Shutting down, the event for RTResource {} is left to the next controller instance!",
+                    rtresource_data.uid
+                );
+                continue;
+            }
             shared_state.working_threads = shared_state.working_threads + 1;
             pthread_cond_signal(&mut shared_state.cond);
             pthread_mutex_unlock(&mut shared_state.mutex);
@@ -126,8 +195,14 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
             /*
             The thread priority is temporarily changed
             according to the criticality of the event being handled.
+            Urgent events are handled with the highest watchdog priority.
             */
-            let param = sched_param{sched_priority: 94 - criticality as i32};
+            let sched_priority = if rtresource_data.urgent {
+                URGENT_WATCHDOG_PRIORITY
+            } else {
+                94 - criticality as i32
+            };
+            let param = sched_param{sched_priority: sched_priority};
             pthread_setschedparam(thread, SCHED_FIFO, &param);
             let mut debug_param = sched_param {sched_priority: 0};
             let mut debug_policy = 0;
@@ -139,7 +214,8 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
                 shared_state.context.client.clone(),
                 rtresource_data.namespace.as_str()
             );
-            let pods_api = shared_state.context.pods.clone();
+            let context = shared_state.context.clone();
+            let config = shared_state.config.clone();
             let pod_lp = kube::api::ListParams::default()
                 .labels(&format!("rtresource_uid={}", rtresource_data.uid));
             let rtresource_data_clone = rtresource_data.clone();
@@ -160,7 +236,68 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
                     pods associated to the RTResource (all accociated pods have the label rtresource_id
                     equal to the UID of the RTResource) and, then we compare the number of deployed replicas 
                     to the desired one and decide whether to scale up or down.
+                    If the RTResource still exists but is being deleted, the controller
+                    finalizer is still on it: we must enforce its deletion policy on the
+                    associated pods and then remove the finalizer to let the deletion complete.
+                    If the desired state of the RTResource was staged by a plan not committed
+                    yet, nothing is done: the RTResource is requeued when the plan is committed.
 		        	*/
+                    Ok(r) if r.metadata.deletion_timestamp.is_some() => {
+                        println!(
+                            "Watchdog - The RTResource {}, {} in namespace {} is being deleted!",
+                            rtresource_data_clone.name,
+                            rtresource_data_clone.uid,
+                            rtresource_data_clone.namespace
+                        );
+                        if has_finalizer(&r) {
+                            let policy = r.spec.deletion_policy.unwrap_or_default();
+                            println!(
+                                "Watchdog - Applying deletion policy {:?} to the pods of RTResource {}!",
+                                policy,
+                                rtresource_data_clone.uid
+                            );
+                            let pod_list = context.list_pods(&pod_lp).await.unwrap();
+                            for i in pod_list.iter() {
+                                let result = match policy {
+                                    DeletionPolicy::Delete => delete_pod("Watchdog".to_string(), client.clone(), i.clone()).await,
+                                    DeletionPolicy::Retain => retain_pod("Watchdog".to_string(), client.clone(), i.clone()).await,
+                                    DeletionPolicy::Orphan => orphan_pod("Watchdog".to_string(), client.clone(), i.clone()).await,
+                                };
+                                if let Err(e) = result {
+                                    eprintln!("{}", e);
+                                }
+                            }
+                            let mut decision = Decision::new(
+                                "Watchdog",
+                                &format!("{:?}", policy),
+                                rtresource_data_clone.name.as_str(),
+                                rtresource_data_clone.uid.as_str(),
+                                rtresource_data_clone.namespace.as_str(),
+                                r.spec.criticality
+                            );
+                            decision.current_replicas = pod_list.len() as i32;
+                            decision.pods = pod_list.len() as i32;
+                            decision.reason = "RTResource deleted, deletion policy enforced".to_string();
+                            record_decision(thread_data as *mut SharedState, decision);
+                            if let Err(e) = remove_finalizer(&rtresource_api, &r).await {
+                                eprintln!(
+                                    "Watchdog - An error occurred while removing the finalizer of RTResource {}: {}",
+                                    rtresource_data_clone.uid,
+                                    e
+                                );
+                            }
+                        }
+                        forget_scale_window(thread_data as *mut SharedState, rtresource_data_clone.uid.as_str());
+                    }
+                    Ok(r) if staged_plan(&r).is_some() => {
+                        println!(
+                            "Watchdog - The RTResource {}, {} in namespace {} is staged by plan {}, waiting for its commit!",
+                            rtresource_data_clone.name,
+                            rtresource_data_clone.uid,
+                            rtresource_data_clone.namespace,
+                            staged_plan(&r).unwrap()
+                        );
+                    }
                     Ok(r) => {
 		        		println!(
                             "Watchdog - The RTResource {}, {} in namespace {} was either created/updated or some of its pods were deleted!",
@@ -170,82 +307,110 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
                         );
 
                         /*
-                        If the RTResource exists, we must update its status first.
+                        We get the pods currently associated to the RTResource.
+                        The debug replica (if any) is not part of the replicas accounting.
+                        A Pod being drained by the drain assistant and its replacement
+                        count as a single replica until the drained Pod is evicted.
+                        */
+                        let (debug_pods, pod_list): (Vec<_>, Vec<_>) = context.list_pods(&pod_lp)
+                            .await
+                            .unwrap()
+                            .into_iter()
+                            .partition(|p| is_debug(p));
+                        let replacements: HashSet<String> = pod_list.iter()
+                            .filter_map(|p| drain_replacement(p).cloned())
+                            .collect();
+                        let is_replacement = |p: &Pod| p.metadata.name
+                            .as_ref()
+                            .map(|n| replacements.contains(n))
+                            .unwrap_or(false);
+                        let pod_count = pod_list.iter().filter(|p| !is_replacement(*p)).count() as i32;
+                        let desired_pod_count = r.spec.replicas.unwrap_or(0);
+
+                        /*
+                        If the RTResource spec changed (or the deployed pods drifted
+                        from the desired replicas), we must update its status first.
                             1. We set the observed generation to the current one.
                             2. We set the desired replicas to the current spec.replicas
                                (current replicas will be updated by the status updater accordingly).
-                            3. We set the conditions accordingly (creating them if it is a new RTResource):
+                            3. We mark the RTResource as admitted (creating the conditions if it is a new RTResource):
                                 - Progressing = True
                                 - Ready = False
                             4. We update the status in the apiserver.
+                        Events that require no scaling (e.g. resyncs of a RTResource
+                        already in its desired state) leave the status untouched,
+                        so that a ready RTResource is not marked as progressing again.
                         */
-                        let mut new_rtresource_status = r.status.clone().unwrap_or_default();
+                        let new_generation = r.status.as_ref().and_then(|s| s.observed_generation) != r.metadata.generation;
+                        let mut latest = r.clone();
+                        if new_generation || desired_pod_count != pod_count {
+                            let mut new_rtresource_status = r.status.clone().unwrap_or_default();
 
-                        new_rtresource_status.observed_generation = r.metadata.generation;
+                            new_rtresource_status.observed_generation = r.metadata.generation;
 
-                        new_rtresource_status.desired_replicas = r.spec.replicas;
+                            new_rtresource_status.desired_replicas = r.spec.replicas;
 
-                        let mut new_rtresource_conditions =  new_rtresource_status.conditions.unwrap_or_default();
-                        let transition_time = chrono::Utc::now().to_rfc3339();
-                        if new_rtresource_conditions.is_empty() {
-                            
-                            new_rtresource_conditions.push(Condition {
-                                condition_type: "Progressing".to_string(),
-                                status: "True".to_string(),
-                                reason: Some("RTResource created".to_string()),
-                                message: Some("RTResource is being processed".to_string()),
-                                last_transition_time: Some(transition_time.clone()),
-                            });
-                            new_rtresource_conditions.push(Condition {
-                                condition_type: "Ready".to_string(),
-                                status: "False".to_string(),
-                                reason: Some("RTResource created".to_string()),
-                                message: Some("Waiting for pods to be ready".to_string()),
-                                last_transition_time: Some(transition_time.clone()),
-                            });
-                        } else {
-                            for cond in &mut new_rtresource_conditions {
-                                if cond.condition_type == "Progressing" {
-                                    cond.status = "True".to_string();
-                                    cond.reason = Some("RTResource Spec changed!".to_string());
-                                    cond.message = Some("RTResource Spec changed!!".to_string());
-                                    cond.last_transition_time = Some(transition_time.clone());
+                            /*
+                            If the RTResource is scaled up from zero replicas, we record
+                            when the scale up was admitted, so that the state updater
+                            can measure its cold-start latency.
+                            */
+                            if pod_count == 0 && desired_pod_count > 0
+                                && (new_generation || new_rtresource_status.scale_up_admitted_at.is_none()) {
+                                new_rtresource_status.scale_up_admitted_at = Some(chrono::Utc::now().to_rfc3339());
+                            }
+
+                            if new_rtresource_status.conditions.is_none() {
+                                mark_admitted(&mut new_rtresource_status, "RTResource created, waiting for pods to be ready");
+                            } else if new_generation {
+                                mark_admitted(&mut new_rtresource_status, "RTResource spec changed, waiting for pods to be ready");
+                            } else {
+                                mark_admitted(&mut new_rtresource_status, "Deployed pods differ from the desired replicas, waiting for pods to be ready");
+                            }
+
+                            let mut updated_resource = r.clone();
+                            updated_resource.status = Some(new_rtresource_status);
+                            let rtresource_namespaced_api = Api::<RTResource>::namespaced(
+                                client.clone(),
+                                r.metadata.namespace.as_ref().unwrap()
+                            );
+                            match rtresource_namespaced_api.replace_status(
+                                &r.metadata.name.as_ref().unwrap(),
+                                &Default::default(),
+                                serde_json::to_vec(&updated_resource).unwrap()
+                            ).await {
+                                Ok(updated) => {
+                                    println!(
+                                        "State Updater - Updated status for RTResource: {}, {} in namespace {}",
+                                        rtresource_data_clone.name,
+                                        rtresource_data_clone.uid,
+                                        rtresource_data_clone.namespace
+                                    );
+                                    latest = updated;
                                 }
-                                if cond.condition_type == "Ready" {
-                                    cond.status = "False".to_string();
-                                    cond.reason = Some("RTResource Spec changed!!".to_string());
-                                    cond.message = Some("RTResource Spec changed!!".to_string());
-                                    cond.last_transition_time = Some(transition_time.clone());
+                                Err(e) => {
+                                    eprintln!(
+                                        "State Updater - An error occurred while updating status for RTResource {}, {} in namespace {}: {}",
+                                        rtresource_data_clone.name,
+                                        rtresource_data_clone.uid,
+                                        rtresource_data_clone.namespace,
+                                        e
+                                    );
                                 }
                             }
                         }
-                        new_rtresource_status.conditions = Some(new_rtresource_conditions);
 
-                        let mut updated_resource = r.clone();
-                        updated_resource.status = Some(new_rtresource_status);
-                        let rtresource_namespaced_api = Api::<RTResource>::namespaced(
-                            client.clone(),
-                            r.metadata.namespace.as_ref().unwrap()
-                        );
-                        match rtresource_namespaced_api.replace_status(
-                            &r.metadata.name.as_ref().unwrap(),
-                            &Default::default(),
-                            serde_json::to_vec(&updated_resource).unwrap()
-                        ).await {
-                            Ok(_) => {
-                                println!(
-                                    "State Updater - Updated status for RTResource: {}, {} in namespace {}",
-                                    rtresource_data_clone.name,
-                                    rtresource_data_clone.uid,
-                                    rtresource_data_clone.namespace
-                                );
-                            }
-                            Err(e) => {
+                        /*
+                        The controller finalizer must be set on the RTResource,
+                        so that its deletion policy can be enforced when it is deleted.
+                        The RTResource returned by the status update (if any) is used,
+                        since the status write changed its resource version.
+                        */
+                        if !has_finalizer(&latest) {
+                            if let Err(e) = add_finalizer(&rtresource_api, &latest).await {
                                 eprintln!(
-                                    "State Updater - An error occurred while updating status for RTResource {}, {} in namespace {}: {}",
-                                    rtresource_data_clone.name,
+                                    "Watchdog - An error occurred while adding the finalizer to RTResource {}: {}",
                                     rtresource_data_clone.uid,
-                                    rtresource_data_clone.namespace,
                                     e
                                 );
                             }
@@ -255,24 +420,178 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
                         Now we can proceed to scale the number of pods
                         associated to the RTResource according to the desired
                         number of replicas.
+                        The number of pods created or deleted is bounded by the
+                        scale velocity limits of the RTResource (if any): when
+                        throttled, the RTResource is requeued by the state updater
+                        as soon as the current scale window expires.
+                        Urgent updates are not bound by the scale up limit,
+                        so that the burst is absorbed as fast as possible.
                         */
-                        let pod_list = pods_api.list(&pod_lp).await.unwrap();
-                        let pod_count = pod_list.items.len() as i32;
-                        let desired_pod_count = r.spec.replicas.unwrap_or(0);
                         let pods_needed = (desired_pod_count - pod_count as i32).abs();
                         if desired_pod_count > pod_count {
-                            for _i in 0..pods_needed {
-                                if let Err(e) = create_pod("Watchdog".to_string(), client.clone(), &r).await{
+                            let allowed = reserve_scale(
+                                thread_data as *mut SharedState,
+                                rtresource_data_clone.uid.as_str(),
+                                pods_needed,
+                                ScaleDirection::Up,
+                                if rtresource_data_clone.urgent { None } else { r.spec.max_scale_up_rate }
+                            );
+                            if allowed < pods_needed {
+                                println!(
+                                    "Watchdog - Scale up of RTResource {} limited to {} out of {} pods by maxScaleUpRate!",
+                                    rtresource_data_clone.uid,
+                                    allowed,
+                                    pods_needed
+                                );
+                            }
+                            for _i in 0..allowed {
+                                if let Err(e) = create_pod("Watchdog".to_string(), client.clone(), &r, &config).await{
                                     eprintln!("{}", e);
                                 }
                             }
+                            let mut decision = Decision::new(
+                                "Watchdog",
+                                "ScaleUp",
+                                rtresource_data_clone.name.as_str(),
+                                rtresource_data_clone.uid.as_str(),
+                                rtresource_data_clone.namespace.as_str(),
+                                r.spec.criticality
+                            );
+                            decision.current_replicas = pod_count;
+                            decision.desired_replicas = desired_pod_count;
+                            decision.pods = allowed;
+                            decision.reason = if allowed < pods_needed {
+                                "Limited by maxScaleUpRate".to_string()
+                            } else if rtresource_data_clone.urgent {
+                                "Urgent update".to_string()
+                            } else {
+                                "Desired replicas increased".to_string()
+                            };
+                            record_decision(thread_data as *mut SharedState, decision);
                         } else if desired_pod_count < pod_count {
-                            for i in pod_list.items.iter().take(pods_needed as usize) {
-                                if let Err(e) = delete_pod("Watchdog".to_string(), client.clone(), i.clone()).await{
+                            /*
+                            Pods executing deadline-critical work (busy) are not
+                            removed until they report idle or the busy timeout expires:
+                            if not enough idle Pods are available, the scale down
+                            is completed when the RTResource is requeued.
+                            Pods being drained and their replacements are only evicted by the
+                            drain assistant, hence they are never removed here, while Pods
+                            running on cordoned nodes are removed first, so that the scale down
+                            does not fight with the node drain.
+                            */
+                            let cordoned_nodes: HashSet<String> = if config.drain_assist {
+                                match context.nodes.list(&kube::api::ListParams::default()).await {
+                                    Ok(list) => list.items
+                                        .into_iter()
+                                        .filter(|n| is_cordoned(n))
+                                        .filter_map(|n| n.metadata.name)
+                                        .collect(),
+                                    Err(e) => {
+                                        eprintln!("Watchdog - An error occurred while listing nodes: {}", e);
+                                        HashSet::new()
+                                    }
+                                }
+                            } else {
+                                HashSet::new()
+                            };
+                            let mut idle_pods: Vec<_> = pod_list.iter()
+                                .filter(|p| !is_busy(p, config.busy_timeout))
+                                .filter(|p| drain_replacement(p).is_none() && !is_replacement(*p))
+                                .collect();
+                            idle_pods.sort_by_key(|p| !is_on_cordoned_node(p, &cordoned_nodes));
+                            let removable = pods_needed.min(idle_pods.len() as i32);
+                            if removable < pods_needed {
+                                println!(
+                                    "Watchdog - Scale down of RTResource {} limited to {} out of {} pods by busy or draining replicas!",
+                                    rtresource_data_clone.uid,
+                                    removable,
+                                    pods_needed
+                                );
+                                defer_scale(thread_data as *mut SharedState, rtresource_data_clone.uid.as_str());
+                            }
+                            let allowed = reserve_scale(
+                                thread_data as *mut SharedState,
+                                rtresource_data_clone.uid.as_str(),
+                                removable,
+                                ScaleDirection::Down,
+                                r.spec.max_scale_down_rate
+                            );
+                            if allowed < removable {
+                                println!(
+                                    "Watchdog - Scale down of RTResource {} limited to {} out of {} pods by maxScaleDownRate!",
+                                    rtresource_data_clone.uid,
+                                    allowed,
+                                    removable
+                                );
+                            }
+                            for i in idle_pods.iter().take(allowed as usize) {
+                                if let Err(e) = delete_pod("Watchdog".to_string(), client.clone(), (*i).clone()).await{
+                                    eprintln!("{}", e);
+                                }
+                            }
+                            let mut decision = Decision::new(
+                                "Watchdog",
+                                "ScaleDown",
+                                rtresource_data_clone.name.as_str(),
+                                rtresource_data_clone.uid.as_str(),
+                                rtresource_data_clone.namespace.as_str(),
+                                r.spec.criticality
+                            );
+                            decision.current_replicas = pod_count;
+                            decision.desired_replicas = desired_pod_count;
+                            decision.pods = allowed;
+                            decision.reason = if allowed < removable {
+                                "Limited by maxScaleDownRate".to_string()
+                            } else if removable < pods_needed {
+                                "Limited by busy or draining replicas".to_string()
+                            } else {
+                                "Desired replicas decreased".to_string()
+                            };
+                            record_decision(thread_data as *mut SharedState, decision);
+                        }
+
+                        /*
+                        The debug replica is deployed or removed
+                        according to the RTResource spec.
+                        */
+                        if r.spec.debug_replica.unwrap_or(false) {
+                            if debug_pods.is_empty() {
+                                if let Err(e) = create_debug_pod("Watchdog".to_string(), client.clone(), &r, &config).await {
+                                    eprintln!("{}", e);
+                                }
+                            }
+                        } else {
+                            for i in debug_pods.iter() {
+                                if let Err(e) = delete_pod("Watchdog".to_string(), client.clone(), i.clone()).await {
                                     eprintln!("{}", e);
                                 }
                             }
                         }
+
+                        /*
+                        The urgent mark only applies to the update that carried it,
+                        hence we remove the annotation once the event has been handled.
+                        */
+                        if rtresource_data_clone.urgent {
+                            let patch = serde_json::json!({
+                                "metadata": {
+                                    "annotations": {
+                                        URGENT_ANNOTATION: null
+                                    }
+                                }
+                            });
+                            if let Err(e) = rtresource_api.patch(
+                                rtresource_data_clone.name.as_str(),
+                                &PatchParams::default(),
+                                &Patch::Merge(&patch)
+                            ).await {
+                                eprintln!(
+                                    "Watchdog - An error occurred while clearing the urgent mark of RTResource {}: {}",
+                                    rtresource_data_clone.uid,
+                                    e
+                                );
+                            }
+                        }
                     }
 		        	Err(e) => {
 		        		match e.to_string().find("404") {
@@ -286,10 +605,13 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
 
                                 /*
                                 If the RTResource received from the priority queue was deleted,
-                                then we must delete all the pods associated to it.
+                                then we must delete all the pods associated to it
+                                (except those retained by its deletion policy)
+                                and forget its scale window.
                                 */
-                                let pod_list = pods_api.list(&pod_lp).await.unwrap();
-                                for i in pod_list.items.iter() {
+                                forget_scale_window(thread_data as *mut SharedState, rtresource_data_clone.uid.as_str());
+                                let pod_list = context.list_pods(&pod_lp).await.unwrap();
+                                for i in pod_list.iter().filter(|p| !is_retained(p)) {
                                     if let Err(e) = delete_pod("Watchdog".to_string(), client.clone(), i.clone()).await{
                                         eprintln!("{}", e);
                                     }
@@ -326,6 +648,11 @@ pub extern "C" fn watchdog(thread_data: *mut c_void) -> *mut c_void {
             working on an event.
             */
     	    pthread_mutex_lock(&mut shared_state.mutex);
+            if let Some(i) = shared_state.in_flight
+                .iter()
+                .position(|m| m.uid == rtresource_data.uid && m.urgent == rtresource_data.urgent) {
+                shared_state.in_flight.remove(i);
+            }
             shared_state.working_threads = shared_state.working_threads - 1;
             let decision = shared_state.active_threads - shared_state.working_threads;
             if decision > shared_state.config.threshold && shared_state.active_threads > shared_state.config.min_watchdogs {
@@ -42,12 +42,20 @@ use anyhow::Result;
 mod utils;
 use utils::configuration::get_controller_configuration;
 use utils::vars::new_shared_state;
+use utils::rbac::{
+    find_missing_permissions,
+    report_missing_permissions
+};
+use utils::migration::migrate_rtresources;
 
 mod components;
 use components::resource_watcher::crd_watcher;
 use components::pod_watcher::pod_watcher;
 use components::resource_state_updater::resource_state_updater;
 use components::event_server::server;
+use components::drain_assistant::drain_assistant;
+use components::plan_applier::plan_applier;
+use components::shutdown::shutdown_handler;
 
 
 
@@ -79,6 +87,34 @@ async fn main() -> Result<(), Box<dyn Error + Send + Sync + 'static>> {
         */
         let client = Client::try_default().await?;
 
+        /*
+        Before starting the pipeline, we check that the controller
+        has all the permissions it needs on RTResources, Pods and Events.
+        If any of them is missing, we report exactly which ones
+        and stop, instead of failing later with Forbidden errors.
+        */
+        let missing_permissions = find_missing_permissions(client.clone(), &config).await;
+        if !missing_permissions.is_empty() {
+            for permission in missing_permissions.iter() {
+                eprintln!("RBAC Check - Missing permission: {}", permission);
+            }
+            report_missing_permissions(client.clone(), &config, &missing_permissions).await;
+            return Err("The controller is missing some of the required permissions!".into());
+        }
+
+        /*
+        If the controller was moved to a new API group, the RTResources
+        of the old group are migrated before starting the pipeline,
+        so that they are reconciled from the first event on.
+        A failed migration is resumed at the next startup.
+        */
+        if !config.migrate_from_group.is_empty() {
+            match migrate_rtresources(client.clone(), &config).await {
+                Ok(migrated) => println!("RTResource Migration - {} RTResources migrated from {}", migrated, config.migrate_from_group),
+                Err(e) => eprintln!("RTResource Migration - The migration from {} did not complete: {}", config.migrate_from_group, e),
+            }
+        }
+
         /*
         We create the Tokio runtime.
         */
@@ -107,13 +143,22 @@ async fn main() -> Result<(), Box<dyn Error + Send + Sync + 'static>> {
               for pods related to the RTResources;
             - a resource state updater that updates the status of RTResources
               accordingly to the relative pods state;
-            - a server in charge of spwning new watchdogs when needed.
+            - a server in charge of spwning new watchdogs when needed;
+            - a plan applier writing the RTPlans to the RTResources
+              (only if enabled in the configuration);
+            - a drain assistant migrating RT pods away from cordoned nodes
+              (only if enabled in the configuration);
+            - a shutdown handler that, on SIGTERM, lets pending events
+              be handled and persists the remaining ones on the RTResources.
         Note: a watchdog is a thread that handles events from the event queue.
         */
         let mut crd_watcher_thread: pthread_t = 0;
         let mut pod_watcher_thread: pthread_t = 0;
         let mut resource_state_updater_thread: pthread_t = 0;
         let mut server_thread: pthread_t = 0;
+        let mut plan_applier_thread: pthread_t = 0;
+        let mut drain_assistant_thread: pthread_t = 0;
+        let mut shutdown_thread: pthread_t = 0;
         let mut attr: pthread_attr_t = mem::zeroed();
         let mut param: sched_param = sched_param{sched_priority: 0};
         let mut result: i32;
@@ -154,6 +199,18 @@ async fn main() -> Result<(), Box<dyn Error + Send + Sync + 'static>> {
             eprintln!("An error occurred while creating the Resource State Updater thread!");
         }
 
+        if config.rt_plans {
+            result = pthread_create(
+                &mut plan_applier_thread,
+                &attr as *const _ as *const pthread_attr_t,
+                plan_applier,
+                share_state_ptr
+            );
+            if result != 0 {
+                eprintln!("An error occurred while creating the Plan Applier thread! {}", result);
+            }
+        }
+
         param.sched_priority = 95;
         pthread_attr_setschedparam(&mut attr, &param);
         result = pthread_create(
@@ -166,16 +223,46 @@ async fn main() -> Result<(), Box<dyn Error + Send + Sync + 'static>> {
             eprintln!("An error occurred while creating the Server thread! {}", result);
         }
 
+        if config.drain_assist {
+            result = pthread_create(
+                &mut drain_assistant_thread,
+                &attr as *const _ as *const pthread_attr_t,
+                drain_assistant,
+                share_state_ptr
+            );
+            if result != 0 {
+                eprintln!("An error occurred while creating the Drain Assistant thread! {}", result);
+            }
+        }
+
+        result = pthread_create(
+            &mut shutdown_thread,
+            &attr as *const _ as *const pthread_attr_t,
+            shutdown_handler,
+            share_state_ptr
+        );
+        if result != 0 {
+            eprintln!("An error occurred while creating the Shutdown Handler thread! {}", result);
+        }
+
         /*
         Now we wait for the created threads to terminate.
         Note: in the current implementation these threads should
         never terminate, since the controller is supposed to
         run indefinitely.
+        The Shutdown Handler thread is not joined: on SIGTERM it
+        ends the whole process through exit(0).
         */
         pthread_join(crd_watcher_thread, ptr::null_mut());
         pthread_join(pod_watcher_thread, ptr::null_mut());
         pthread_join(resource_state_updater_thread, ptr::null_mut());
         pthread_join(server_thread, ptr::null_mut());
+        if plan_applier_thread != 0 {
+            pthread_join(plan_applier_thread, ptr::null_mut());
+        }
+        if drain_assistant_thread != 0 {
+            pthread_join(drain_assistant_thread, ptr::null_mut());
+        }
 
         /*
         Cleanup phase.
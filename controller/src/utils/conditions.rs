@@ -0,0 +1,188 @@
+/*
+This file contains helper functions to manipulate
+the conditions reported in the RTResource status,
+so that all the controller components handle them
+in the same way.
+*/
+
+use crate::utils::rtresource::{
+    Condition,
+    RTResourceStatus
+};
+
+
+
+/*
+Condition types used in the RTResource status
+*/
+pub const CONDITION_PROGRESSING: &str = "Progressing";
+pub const CONDITION_READY: &str = "Ready";
+
+/*
+Condition status values
+*/
+pub const STATUS_TRUE: &str = "True";
+pub const STATUS_FALSE: &str = "False";
+
+/*
+Machine-readable reasons used in the RTResource conditions
+*/
+pub const REASON_ADMITTED: &str = "Admitted";
+pub const REASON_CAPACITY_PENDING: &str = "CapacityPending";
+pub const REASON_REPLICAS_READY: &str = "ReplicasReady";
+
+/*
+This function returns the condition of the given type,
+if present in the RTResource status.
+*/
+pub fn get_condition<'a>(status: &'a RTResourceStatus, condition_type: &str) -> Option<&'a Condition> {
+    status.conditions
+        .as_ref()
+        .and_then(|conditions| conditions.iter().find(|c| c.condition_type == condition_type))
+}
+
+/*
+This function sets the condition of the given type
+in the RTResource status, creating it if needed.
+The last transition time is only updated when the
+condition status actually changes, reason and message
+are always overwritten.
+*/
+pub fn set_condition(
+    status: &mut RTResourceStatus,
+    condition_type: &str,
+    condition_status: &str,
+    reason: &str,
+    message: &str
+) {
+    let transition_time = chrono::Utc::now().to_rfc3339();
+    let conditions = status.conditions.get_or_insert_with(Vec::new);
+    match conditions.iter_mut().find(|c| c.condition_type == condition_type) {
+        Some(cond) => {
+            if cond.status != condition_status {
+                cond.status = condition_status.to_string();
+                cond.last_transition_time = Some(transition_time);
+            }
+            cond.reason = Some(reason.to_string());
+            cond.message = Some(message.to_string());
+        }
+        None => {
+            conditions.push(Condition {
+                condition_type: condition_type.to_string(),
+                status: condition_status.to_string(),
+                last_transition_time: Some(transition_time),
+                reason: Some(reason.to_string()),
+                message: Some(message.to_string()),
+            });
+        }
+    }
+}
+
+/*
+This function marks the RTResource as admitted by the controller:
+its current spec is being processed, hence it is progressing
+and not ready until the desired replicas are running.
+*/
+pub fn mark_admitted(status: &mut RTResourceStatus, message: &str) {
+    set_condition(status, CONDITION_PROGRESSING, STATUS_TRUE, REASON_ADMITTED, message);
+    set_condition(status, CONDITION_READY, STATUS_FALSE, REASON_ADMITTED, message);
+}
+
+/*
+This function marks the RTResource as waiting for capacity:
+the controller is still progressing towards the desired
+replicas, but not all of them are running yet.
+*/
+pub fn mark_capacity_pending(status: &mut RTResourceStatus, message: &str) {
+    set_condition(status, CONDITION_PROGRESSING, STATUS_TRUE, REASON_CAPACITY_PENDING, message);
+    set_condition(status, CONDITION_READY, STATUS_FALSE, REASON_CAPACITY_PENDING, message);
+}
+
+/*
+This function marks the RTResource as ready:
+all the desired replicas are running.
+*/
+pub fn mark_ready(status: &mut RTResourceStatus, message: &str) {
+    set_condition(status, CONDITION_PROGRESSING, STATUS_FALSE, REASON_REPLICAS_READY, message);
+    set_condition(status, CONDITION_READY, STATUS_TRUE, REASON_REPLICAS_READY, message);
+}
+
+/*
+This function checks whether the condition of the given
+type is present and set to "True".
+*/
+pub fn is_condition_true(status: &RTResourceStatus, condition_type: &str) -> bool {
+    get_condition(status, condition_type)
+        .map(|c| c.status == STATUS_TRUE)
+        .unwrap_or(false)
+}
+
+/*
+This function checks whether the RTResource is ready.
+*/
+pub fn is_ready(status: &RTResourceStatus) -> bool {
+    is_condition_true(status, CONDITION_READY)
+}
+
+/*
+This function checks whether the RTResource is progressing.
+*/
+pub fn is_progressing(status: &RTResourceStatus) -> bool {
+    is_condition_true(status, CONDITION_PROGRESSING)
+}
+
+
+
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn set_condition_creates_missing_condition() {
+        let mut status = RTResourceStatus::default();
+        set_condition(&mut status, CONDITION_READY, STATUS_FALSE, REASON_ADMITTED, "admitted");
+        let condition = get_condition(&status, CONDITION_READY).unwrap();
+        assert_eq!(condition.status, STATUS_FALSE);
+        assert_eq!(condition.reason.as_deref(), Some(REASON_ADMITTED));
+        assert_eq!(condition.message.as_deref(), Some("admitted"));
+        assert!(condition.last_transition_time.is_some());
+        assert_eq!(status.conditions.as_ref().unwrap().len(), 1);
+    }
+
+    #[test]
+    fn set_condition_keeps_transition_time_if_status_is_unchanged() {
+        let mut status = RTResourceStatus::default();
+        set_condition(&mut status, CONDITION_READY, STATUS_FALSE, REASON_ADMITTED, "admitted");
+        status.conditions.as_mut().unwrap()[0].last_transition_time = Some("then".to_string());
+        set_condition(&mut status, CONDITION_READY, STATUS_FALSE, REASON_CAPACITY_PENDING, "pending");
+        let condition = get_condition(&status, CONDITION_READY).unwrap();
+        assert_eq!(condition.last_transition_time.as_deref(), Some("then"));
+        assert_eq!(condition.reason.as_deref(), Some(REASON_CAPACITY_PENDING));
+        assert_eq!(condition.message.as_deref(), Some("pending"));
+    }
+
+    #[test]
+    fn set_condition_updates_transition_time_on_status_change() {
+        let mut status = RTResourceStatus::default();
+        set_condition(&mut status, CONDITION_READY, STATUS_FALSE, REASON_ADMITTED, "admitted");
+        status.conditions.as_mut().unwrap()[0].last_transition_time = Some("then".to_string());
+        set_condition(&mut status, CONDITION_READY, STATUS_TRUE, REASON_REPLICAS_READY, "ready");
+        let condition = get_condition(&status, CONDITION_READY).unwrap();
+        assert_eq!(condition.status, STATUS_TRUE);
+        assert_ne!(condition.last_transition_time.as_deref(), Some("then"));
+        assert!(is_ready(&status));
+    }
+
+    #[test]
+    fn conditions_are_tracked_by_type() {
+        let mut status = RTResourceStatus::default();
+        mark_admitted(&mut status, "admitted");
+        assert!(is_progressing(&status));
+        assert!(!is_ready(&status));
+        mark_ready(&mut status, "ready");
+        assert!(!is_progressing(&status));
+        assert!(is_ready(&status));
+        assert_eq!(status.conditions.as_ref().unwrap().len(), 2);
+    }
+}
@@ -8,6 +8,11 @@ use std::{
     fmt
 };
 
+use crate::utils::profiles::{
+    ResourceProfile,
+    parse_resource_profiles
+};
+
 
 
 /*
@@ -19,6 +24,22 @@ pub struct ControllerConfig {
     pub max_watchdogs: usize,           // Maximum number of watchdog threads
     pub threshold: usize,               // Threshold triggering watchdog threads scaling
     pub event_queue_path: String,       // Path to the event priority queue
+    pub pod_name: String,               // Name of the controller Pod
+    pub pod_namespace: String,          // Namespace of the controller Pod
+    pub resource_profiles: Vec<ResourceProfile>, // Per-criticality default resource profiles
+    pub rt_readiness_gate: bool,        // Whether managed Pods get the RT readiness gate
+    pub drain_assist: bool,             // Whether cordoned nodes are drained by the controller
+    pub drain_assist_period: u64,       // Period (in seconds) of the drain assistant checks
+    pub decision_log_path: String,      // Path of the decision log (disabled if empty)
+    pub decision_log_max_bytes: u64,    // Size triggering the decision log rotation
+    pub decision_log_max_files: usize,  // Number of rotated decision logs kept
+    pub watch_namespaces: Vec<String>,  // Namespaces watched by the controller (all if empty)
+    pub migrate_from_group: String,     // GroupVersion RTResources are migrated from (disabled if empty)
+    pub resync_period: u64,             // Period (in seconds) of the RTResources resync (disabled if 0)
+    pub resync_jitter: u64,             // Maximum per-RTResource offset (in seconds) of the resync
+    pub busy_timeout: u64,              // Time (in seconds) after which busy Pods can be removed anyway
+    pub rt_plans: bool,                 // Whether RTPlans are applied by the controller
+    pub shutdown_timeout: u64,          // Time (in seconds) given to pending events on shutdown
 }
 
 /*
@@ -31,7 +52,30 @@ impl fmt::Display for ControllerConfig {
         writeln!(f, "    Min watchdogs: {}", self.min_watchdogs)?;
         writeln!(f, "    Max watchdogs: {}", self.max_watchdogs)?;
         writeln!(f, "    Threshold: {}", self.threshold)?;
-        writeln!(f, "    Event Queue Path: {}", self.event_queue_path)
+        writeln!(f, "    Event Queue Path: {}", self.event_queue_path)?;
+        writeln!(f, "    Pod Name: {}", self.pod_name)?;
+        writeln!(f, "    Pod Namespace: {}", self.pod_namespace)?;
+        writeln!(f, "    Resource Profiles: {}", self.resource_profiles.len())?;
+        for profile in self.resource_profiles.iter() {
+            writeln!(f, "        {}", profile)?;
+        }
+        writeln!(f, "    RT Readiness Gate: {}", self.rt_readiness_gate)?;
+        writeln!(f, "    Drain Assist: {}", self.drain_assist)?;
+        writeln!(f, "    Drain Assist Period: {}s", self.drain_assist_period)?;
+        writeln!(f, "    Decision Log Path: {}", self.decision_log_path)?;
+        writeln!(f, "    Decision Log Max Bytes: {}", self.decision_log_max_bytes)?;
+        writeln!(f, "    Decision Log Max Files: {}", self.decision_log_max_files)?;
+        if self.watch_namespaces.is_empty() {
+            writeln!(f, "    Watch Namespaces: all")?;
+        } else {
+            writeln!(f, "    Watch Namespaces: {}", self.watch_namespaces.join(", "))?;
+        }
+        writeln!(f, "    Migrate From Group: {}", self.migrate_from_group)?;
+        writeln!(f, "    Resync Period: {}s", self.resync_period)?;
+        writeln!(f, "    Resync Jitter: {}s", self.resync_jitter)?;
+        writeln!(f, "    Busy Timeout: {}s", self.busy_timeout)?;
+        writeln!(f, "    RT Plans: {}", self.rt_plans)?;
+        writeln!(f, "    Shutdown Timeout: {}s", self.shutdown_timeout)
     }
 }
 
@@ -77,6 +121,175 @@ fn get_event_queue_path() -> String {
     .unwrap_or_else(|_| "/eventqueue".to_string())
 }
 
+/*
+This function retrieves the controller Pod name
+from the environment variable "POD_NAME".
+*/
+fn get_pod_name() -> String {
+    env::var("POD_NAME")
+    .unwrap_or_else(|_| "preempt-k8s".to_string())
+}
+
+/*
+This function retrieves the controller Pod namespace
+from the environment variable "POD_NAMESPACE".
+*/
+fn get_pod_namespace() -> String {
+    env::var("POD_NAMESPACE")
+    .unwrap_or_else(|_| "realtime".to_string())
+}
+
+/*
+This function retrieves the per-criticality default resource
+profiles from the environment variable "RESOURCE_PROFILES".
+*/
+fn get_resource_profiles() -> Vec<ResourceProfile> {
+    env::var("RESOURCE_PROFILES")
+        .map(|v| parse_resource_profiles(&v))
+        .unwrap_or_default() // No profiles is the Default Value
+}
+
+/*
+This function retrieves whether the RT readiness gate must be
+injected in managed Pods from the environment variable "RT_READINESS_GATE".
+*/
+fn get_rt_readiness_gate() -> bool {
+    env::var("RT_READINESS_GATE")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(false) // false is the Default Value
+}
+
+/*
+This function retrieves whether cordoned nodes must be drained
+by the controller from the environment variable "DRAIN_ASSIST".
+*/
+fn get_drain_assist() -> bool {
+    env::var("DRAIN_ASSIST")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(false) // false is the Default Value
+}
+
+/*
+This function retrieves the period (in seconds) of the drain
+assistant checks from the environment variable "DRAIN_ASSIST_PERIOD".
+*/
+fn get_drain_assist_period() -> u64 {
+    env::var("DRAIN_ASSIST_PERIOD")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(5) // 5 is the Default Value
+}
+
+/*
+This function retrieves the decision log path from the
+environment variable "DECISION_LOG_PATH".
+*/
+fn get_decision_log_path() -> String {
+    env::var("DECISION_LOG_PATH")
+    .unwrap_or_default() // Empty (disabled) is the Default Value
+}
+
+/*
+This function retrieves the size triggering the decision log
+rotation from the environment variable "DECISION_LOG_MAX_BYTES".
+*/
+fn get_decision_log_max_bytes() -> u64 {
+    env::var("DECISION_LOG_MAX_BYTES")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(10485760) // 10 MiB is the Default Value
+}
+
+/*
+This function retrieves the number of rotated decision logs
+kept from the environment variable "DECISION_LOG_MAX_FILES".
+*/
+fn get_decision_log_max_files() -> usize {
+    env::var("DECISION_LOG_MAX_FILES")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(5) // 5 is the Default Value
+}
+
+/*
+This function retrieves the namespaces watched by the controller
+from the environment variable "WATCH_NAMESPACES" (comma-separated).
+*/
+fn get_watch_namespaces() -> Vec<String> {
+    env::var("WATCH_NAMESPACES")
+        .map(|v| v.split(',')
+            .map(|ns| ns.trim().to_string())
+            .filter(|ns| !ns.is_empty())
+            .collect())
+        .unwrap_or_default() // Empty (cluster-wide) is the Default Value
+}
+
+/*
+This function retrieves the GroupVersion (e.g. "rtgroup.research.com/v1")
+RTResources must be migrated from at startup
+from the environment variable "MIGRATE_FROM_GROUP".
+*/
+fn get_migrate_from_group() -> String {
+    env::var("MIGRATE_FROM_GROUP")
+    .unwrap_or_default() // Empty (disabled) is the Default Value
+}
+
+/*
+This function retrieves the period (in seconds) of the
+RTResources resync from the environment variable "RESYNC_PERIOD".
+*/
+fn get_resync_period() -> u64 {
+    env::var("RESYNC_PERIOD")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(0) // 0 (disabled) is the Default Value
+}
+
+/*
+This function retrieves the maximum per-RTResource offset (in seconds)
+of the resync from the environment variable "RESYNC_JITTER".
+*/
+fn get_resync_jitter() -> u64 {
+    env::var("RESYNC_JITTER")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(30) // 30 is the Default Value
+}
+
+/*
+This function retrieves the time (in seconds) after which busy Pods
+can be removed anyway from the environment variable "BUSY_TIMEOUT".
+*/
+fn get_busy_timeout() -> u64 {
+    env::var("BUSY_TIMEOUT")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(120) // 120 is the Default Value
+}
+
+/*
+This function retrieves whether RTPlans are applied
+by the controller from the environment variable "RT_PLANS".
+*/
+fn get_rt_plans() -> bool {
+    env::var("RT_PLANS")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(false) // false is the Default Value
+}
+
+/*
+This function retrieves the time (in seconds) given to pending
+events on shutdown from the environment variable "SHUTDOWN_TIMEOUT".
+*/
+fn get_shutdown_timeout() -> u64 {
+    env::var("SHUTDOWN_TIMEOUT")
+        .ok()
+        .and_then(|v| v.parse().ok())
+        .unwrap_or(20) // 20 is the Default Value
+}
 
 /*
 This function retrieves the
@@ -88,5 +301,21 @@ pub fn get_controller_configuration() -> ControllerConfig{
         max_watchdogs: get_maximum_watchdog_thread_number(),
         threshold: get_threshold_number(),
         event_queue_path: get_event_queue_path(),
+        pod_name: get_pod_name(),
+        pod_namespace: get_pod_namespace(),
+        resource_profiles: get_resource_profiles(),
+        rt_readiness_gate: get_rt_readiness_gate(),
+        drain_assist: get_drain_assist(),
+        drain_assist_period: get_drain_assist_period(),
+        decision_log_path: get_decision_log_path(),
+        decision_log_max_bytes: get_decision_log_max_bytes(),
+        decision_log_max_files: get_decision_log_max_files(),
+        watch_namespaces: get_watch_namespaces(),
+        migrate_from_group: get_migrate_from_group(),
+        resync_period: get_resync_period(),
+        resync_jitter: get_resync_jitter(),
+        busy_timeout: get_busy_timeout(),
+        rt_plans: get_rt_plans(),
+        shutdown_timeout: get_shutdown_timeout(),
     }
 }
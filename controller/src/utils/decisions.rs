@@ -0,0 +1,273 @@
+/*
+This file contains the optional decision log of the
+Preempt-K8s controller: every scaling decision taken by
+the controller threads is written to a pluggable sink,
+so that experiments can collect complete decision datasets.
+Decisions are handed over to a background writer thread,
+so that the controller threads never wait on the sink.
+*/
+
+use std::{
+    fs::{
+        self,
+        File,
+        OpenOptions
+    },
+    io::Write,
+    error::Error,
+    thread,
+    sync::mpsc::{
+        channel,
+        Sender
+    }
+};
+use serde::Serialize;
+
+use crate::utils::vars::SharedState;
+use crate::utils::configuration::ControllerConfig;
+
+
+
+/*
+Scaling decision taken by the controller
+*/
+#[derive(Serialize, Clone, Debug)]
+pub struct Decision {
+    pub timestamp: String,          // When the decision was taken (RFC 3339)
+    pub component: String,          // Component that took the decision
+    pub action: String,             // Decided action (e.g. ScaleUp, ScaleDown, Delete)
+    pub name: String,               // RTResource name
+    pub uid: String,                // RTResource UID
+    pub namespace: String,          // RTResource namespace
+    pub criticality: u32,           // RTResource criticality level
+    pub current_replicas: i32,      // Replicas before the decision
+    pub desired_replicas: i32,      // Replicas requested by the RTResource
+    pub pods: i32,                  // Pods created or removed by the decision
+    pub reason: String,             // Human-readable reason
+}
+
+impl Decision {
+    pub fn new(component: &str, action: &str, name: &str, uid: &str, namespace: &str, criticality: u32) -> Self {
+        Decision {
+            timestamp: chrono::Utc::now().to_rfc3339(),
+            component: component.to_string(),
+            action: action.to_string(),
+            name: name.to_string(),
+            uid: uid.to_string(),
+            namespace: namespace.to_string(),
+            criticality: criticality,
+            current_replicas: 0,
+            desired_replicas: 0,
+            pods: 0,
+            reason: "".to_string(),
+        }
+    }
+}
+
+/*
+Decision sink interface: new stores (e.g. databases
+or object stores) can be plugged in by implementing it
+*/
+pub trait DecisionSink: Send {
+    fn record(&mut self, decision: &Decision) -> Result<(), Box<dyn Error>>;
+}
+
+/*
+Decision sink writing one JSON document per line to a file,
+rotated once it exceeds the configured size:
+the current file is renamed to <path>.1, <path>.1 to <path>.2
+and so on, keeping at most max_files rotated files.
+*/
+pub struct FileDecisionSink {
+    path: String,
+    max_bytes: u64,
+    max_files: usize,
+    file: File,
+    written: u64,
+}
+
+impl FileDecisionSink {
+    pub fn new(path: &str, max_bytes: u64, max_files: usize) -> Result<Self, Box<dyn Error>> {
+        let file = OpenOptions::new().create(true).append(true).open(path)?;
+        let written = file.metadata()?.len();
+        Ok(FileDecisionSink {
+            path: path.to_string(),
+            max_bytes: max_bytes,
+            max_files: max_files,
+            file: file,
+            written: written,
+        })
+    }
+
+    fn rotate(&mut self) -> Result<(), Box<dyn Error>> {
+        if self.max_files > 0 {
+            for i in (1..self.max_files).rev() {
+                let from = format!("{}.{}", self.path, i);
+                if fs::metadata(&from).is_ok() {
+                    fs::rename(&from, format!("{}.{}", self.path, i + 1))?;
+                }
+            }
+            fs::rename(&self.path, format!("{}.1", self.path))?;
+        }
+        self.file = OpenOptions::new().create(true).write(true).truncate(true).open(&self.path)?;
+        self.written = 0;
+
+        Ok(())
+    }
+}
+
+impl DecisionSink for FileDecisionSink {
+    fn record(&mut self, decision: &Decision) -> Result<(), Box<dyn Error>> {
+        let mut line = serde_json::to_vec(decision)?;
+        line.push(b'\n');
+        if self.written > 0 && self.written + line.len() as u64 > self.max_bytes {
+            self.rotate()?;
+        }
+        self.file.write_all(&line)?;
+        self.written = self.written + line.len() as u64;
+
+        Ok(())
+    }
+}
+
+/*
+This function creates the decision sink
+according to the controller configuration
+(None if the decision log is disabled).
+*/
+fn new_decision_sink(config: &ControllerConfig) -> Option<Box<dyn DecisionSink>> {
+    if config.decision_log_path.is_empty() {
+        return None;
+    }
+    match FileDecisionSink::new(
+        &config.decision_log_path,
+        config.decision_log_max_bytes,
+        config.decision_log_max_files
+    ) {
+        Ok(sink) => Some(Box::new(sink)),
+        Err(e) => {
+            eprintln!("Decision Log - An error occurred while opening {}: {}! Decisions will not be logged!", config.decision_log_path, e);
+            None
+        }
+    }
+}
+
+/*
+This function starts the background thread writing decisions
+to the decision sink configured for the controller and returns
+the channel decisions are sent through (None if the decision
+log is disabled).
+*/
+pub fn start_decision_writer(config: &ControllerConfig) -> Option<Sender<Decision>> {
+    let mut sink = new_decision_sink(config)?;
+    let (sender, receiver) = channel::<Decision>();
+    let result = thread::Builder::new()
+        .name("decision-log".to_string())
+        .spawn(move || {
+            for decision in receiver {
+                if let Err(e) = sink.record(&decision) {
+                    eprintln!("Decision Log - An error occurred while recording a decision: {}", e);
+                }
+            }
+        });
+    match result {
+        Ok(_) => Some(sender),
+        Err(e) => {
+            eprintln!("Decision Log - An error occurred while starting the writer thread: {}! Decisions will not be logged!", e);
+            None
+        }
+    }
+}
+
+/*
+This function hands a decision over to
+the decision writer of the shared state, if any.
+*/
+pub fn record_decision(shared_state: *mut SharedState, decision: Decision) {
+    unsafe {
+        let shared_state = &*shared_state;
+        if let Some(decision_log) = shared_state.decision_log.as_ref() {
+            if decision_log.send(decision).is_err() {
+                eprintln!("Decision Log - The writer thread stopped, the decision was not recorded!");
+            }
+        }
+    }
+}
+
+
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::path::PathBuf;
+
+    fn temp_dir(test: &str) -> PathBuf {
+        let dir = std::env::temp_dir().join(format!("preempt-k8s-{}-{}", test, std::process::id()));
+        let _ = fs::remove_dir_all(&dir);
+        fs::create_dir_all(&dir).unwrap();
+        dir
+    }
+
+    fn decision(name: &str) -> Decision {
+        Decision::new("Watchdog", "ScaleUp", name, "uid", "default", 1)
+    }
+
+    fn names(path: &str) -> Vec<String> {
+        fs::read_to_string(path)
+            .unwrap()
+            .lines()
+            .map(|line| serde_json::from_str::<serde_json::Value>(line).unwrap()["name"].as_str().unwrap().to_string())
+            .collect()
+    }
+
+    #[test]
+    fn appends_below_the_size_limit() {
+        let dir = temp_dir("append");
+        let path = dir.join("decisions.log").to_string_lossy().to_string();
+        let mut sink = FileDecisionSink::new(&path, 1 << 20, 2).unwrap();
+        sink.record(&decision("a")).unwrap();
+        sink.record(&decision("b")).unwrap();
+        assert_eq!(names(&path), vec!["a", "b"]);
+        assert!(fs::metadata(format!("{}.1", path)).is_err());
+        fs::remove_dir_all(&dir).unwrap();
+    }
+
+    #[test]
+    fn rotates_keeping_max_files() {
+        let dir = temp_dir("rotate");
+        let path = dir.join("decisions.log").to_string_lossy().to_string();
+        let mut sink = FileDecisionSink::new(&path, 1, 2).unwrap();
+        for name in ["a", "b", "c", "d"] {
+            sink.record(&decision(name)).unwrap();
+        }
+        assert_eq!(names(&path), vec!["d"]);
+        assert_eq!(names(&format!("{}.1", path)), vec!["c"]);
+        assert_eq!(names(&format!("{}.2", path)), vec!["b"]);
+        assert!(fs::metadata(format!("{}.3", path)).is_err());
+        fs::remove_dir_all(&dir).unwrap();
+    }
+
+    #[test]
+    fn truncates_without_rotated_files() {
+        let dir = temp_dir("truncate");
+        let path = dir.join("decisions.log").to_string_lossy().to_string();
+        let mut sink = FileDecisionSink::new(&path, 1, 0).unwrap();
+        sink.record(&decision("a")).unwrap();
+        sink.record(&decision("b")).unwrap();
+        assert_eq!(names(&path), vec!["b"]);
+        assert!(fs::metadata(format!("{}.1", path)).is_err());
+        fs::remove_dir_all(&dir).unwrap();
+    }
+
+    #[test]
+    fn resumes_the_size_of_an_existing_file() {
+        let dir = temp_dir("resume");
+        let path = dir.join("decisions.log").to_string_lossy().to_string();
+        FileDecisionSink::new(&path, 1, 1).unwrap().record(&decision("a")).unwrap();
+        let mut sink = FileDecisionSink::new(&path, 1, 1).unwrap();
+        sink.record(&decision("b")).unwrap();
+        assert_eq!(names(&path), vec!["b"]);
+        assert_eq!(names(&format!("{}.1", path)), vec!["a"]);
+        fs::remove_dir_all(&dir).unwrap();
+    }
+}
@@ -0,0 +1,99 @@
+/*
+This file contains the functions used to manage the finalizer
+the Preempt-K8s controller sets on RTResources, so that the
+deletion policy of an RTResource is enforced before it is removed.
+*/
+
+use std::error::Error;
+use kube::{
+    Api,
+    api::{
+        Patch,
+        PatchParams
+    }
+};
+
+use crate::utils::rtresource::RTResource;
+
+
+
+/*
+Finalizer set by the controller on RTResources
+*/
+pub const RTRESOURCE_FINALIZER: &str = "rtgroup.critical.com/finalizer";
+
+/*
+Maximum number of attempts of a finalizers update
+rejected because the RTResource changed meanwhile
+*/
+const FINALIZER_UPDATE_ATTEMPTS: usize = 5;
+
+/*
+This function checks whether the RTResource
+carries the controller finalizer.
+*/
+pub fn has_finalizer(rtresource: &RTResource) -> bool {
+    rtresource.metadata.finalizers
+        .as_ref()
+        .map(|f| f.iter().any(|name| name == RTRESOURCE_FINALIZER))
+        .unwrap_or(false)
+}
+
+/*
+This function replaces the finalizers of the RTResource with those
+computed by "update" from the current ones.
+The resource version is sent along with the patch, so that the update
+fails if the finalizers changed meanwhile: on conflict, the RTResource
+is read again and the update retried with the fresh finalizers.
+*/
+async fn update_finalizers(
+    rtresource_api: &Api<RTResource>,
+    rtresource: &RTResource,
+    update: impl Fn(Vec<String>) -> Vec<String>
+) -> Result<(), Box<dyn Error>> {
+    let name = rtresource.metadata.name.clone().unwrap();
+    let mut current = rtresource.clone();
+    let mut attempt = 1;
+    loop {
+        let finalizers = update(current.metadata.finalizers.clone().unwrap_or_default());
+        let patch = serde_json::json!({
+            "metadata": {
+                "resourceVersion": current.metadata.resource_version,
+                "finalizers": finalizers
+            }
+        });
+        match rtresource_api.patch(&name, &PatchParams::default(), &Patch::Merge(&patch)).await {
+            Ok(_) => return Ok(()),
+            Err(kube::Error::Api(e)) if e.code == 409 && attempt < FINALIZER_UPDATE_ATTEMPTS => {
+                current = rtresource_api.get(&name).await?;
+                attempt = attempt + 1;
+            }
+            Err(e) => return Err(e.into()),
+        }
+    }
+}
+
+/*
+This function adds the controller finalizer to the RTResource.
+*/
+pub async fn add_finalizer(rtresource_api: &Api<RTResource>, rtresource: &RTResource) -> Result<(), Box<dyn Error>> {
+    update_finalizers(rtresource_api, rtresource, |mut finalizers| {
+        if !finalizers.iter().any(|name| name == RTRESOURCE_FINALIZER) {
+            finalizers.push(RTRESOURCE_FINALIZER.to_string());
+        }
+        finalizers
+    }).await
+}
+
+/*
+This function removes the controller finalizer from the RTResource,
+letting the API Server complete its deletion.
+*/
+pub async fn remove_finalizer(rtresource_api: &Api<RTResource>, rtresource: &RTResource) -> Result<(), Box<dyn Error>> {
+    update_finalizers(rtresource_api, rtresource, |finalizers| {
+        finalizers
+            .into_iter()
+            .filter(|name| name != RTRESOURCE_FINALIZER)
+            .collect()
+    }).await
+}
@@ -0,0 +1,182 @@
+/*
+This file contains the startup migration of RTResources
+from a previous API group (e.g. the research group name)
+to the one served by the Preempt-K8s controller, so that
+clusters can move between group names without manual work.
+*/
+
+use std::error::Error;
+use kube::{
+    Api,
+    Client,
+    ResourceExt,
+    api::{
+        ApiResource,
+        DeleteParams,
+        DynamicObject,
+        GroupVersionKind,
+        ListParams,
+        Patch,
+        PatchParams,
+        PostParams
+    }
+};
+use k8s_openapi::{
+    api::core::v1::Pod,
+    apimachinery::pkg::apis::meta::v1::ObjectMeta
+};
+
+use crate::utils::rtresource::{
+    RTResource,
+    RTResourceSpec
+};
+use crate::utils::configuration::ControllerConfig;
+
+
+
+/*
+This function returns the interfaces with the RTResources of the
+old group, one for each watched namespace (or a cluster-wide one).
+*/
+fn old_rtresource_apis(client: Client, config: &ControllerConfig, resource: &ApiResource) -> Vec<Api<DynamicObject>> {
+    if config.watch_namespaces.is_empty() {
+        vec![Api::all_with(client, resource)]
+    } else {
+        config.watch_namespaces
+            .iter()
+            .map(|ns| Api::namespaced_with(client.clone(), ns, resource))
+            .collect()
+    }
+}
+
+/*
+This function creates the mirror of an old RTResource in the new group
+(if it does not exist yet) and returns it.
+Only name, namespace, labels, annotations and spec are copied:
+the status is rebuilt by the controller.
+*/
+async fn mirror_rtresource(client: Client, old: &DynamicObject) -> Result<RTResource, Box<dyn Error>> {
+    let name = old.name_any();
+    let namespace = old.namespace().unwrap_or_default();
+    let rtresource_api: Api<RTResource> = Api::namespaced(client, &namespace);
+    if let Some(existing) = rtresource_api.get_opt(&name).await? {
+        return Ok(existing);
+    }
+
+    let spec: RTResourceSpec = serde_json::from_value(old.data["spec"].clone())?;
+    let mut rtresource = RTResource::new(&name, spec);
+    rtresource.metadata = ObjectMeta {
+        name: Some(name.clone()),
+        namespace: Some(namespace.clone()),
+        labels: old.metadata.labels.clone(),
+        annotations: old.metadata.annotations.clone(),
+        ..Default::default()
+    };
+    let created = rtresource_api.create(&PostParams::default(), &rtresource).await?;
+    println!("RTResource Migration - Mirrored RTResource {} in namespace {}", name, namespace);
+
+    Ok(created)
+}
+
+/*
+This function moves the Pods of the old RTResource (deployed in
+the namespace of its spec) to its mirror by updating their controller
+labels, so that the running replicas are adopted instead of being recreated.
+*/
+async fn adopt_pods(client: Client, old: &DynamicObject, new: &RTResource) -> Result<(), Box<dyn Error>> {
+    let old_uid = old.uid().unwrap_or_default();
+    let new_uid = new.uid().unwrap_or_default();
+    let pods_api: Api<Pod> = Api::namespaced(client, &new.spec.namespace);
+    let lp = ListParams::default().labels(&format!("rtresource_uid={}", old_uid));
+    for pod in pods_api.list(&lp).await?.items {
+        let patch = serde_json::json!({
+            "metadata": {
+                "labels": {
+                    "rtresource_uid": new_uid
+                }
+            }
+        });
+        pods_api.patch(&pod.name_any(), &PatchParams::default(), &Patch::Merge(&patch)).await?;
+    }
+
+    Ok(())
+}
+
+/*
+This function checks that the mirror carries
+the same specification of the old RTResource.
+*/
+fn check_parity(old: &DynamicObject, new: &RTResource) -> bool {
+    let old_spec = serde_json::from_value::<RTResourceSpec>(old.data["spec"].clone())
+        .ok()
+        .and_then(|s| serde_json::to_value(s).ok());
+    let new_spec = serde_json::to_value(&new.spec).ok();
+    old_spec.is_some() && old_spec == new_spec
+}
+
+/*
+This function deletes the old RTResource.
+Its finalizers are removed first, since no controller
+is reconciling the old group anymore.
+*/
+async fn delete_old_rtresource(client: Client, resource: &ApiResource, old: &DynamicObject) -> Result<(), Box<dyn Error>> {
+    let namespace = old.namespace().unwrap_or_default();
+    let old_api: Api<DynamicObject> = Api::namespaced_with(client, &namespace, resource);
+    let patch = serde_json::json!({
+        "metadata": {
+            "finalizers": null
+        }
+    });
+    old_api.patch(&old.name_any(), &PatchParams::default(), &Patch::Merge(&patch)).await?;
+    old_api.delete(&old.name_any(), &DeleteParams::default()).await?;
+
+    Ok(())
+}
+
+/*
+This function migrates the RTResources of the configured old group
+to the group served by the controller, in three steps:
+    1. every old RTResource is mirrored in the new group;
+    2. the parity of every mirror with its original is verified;
+    3. only if all the mirrors are on par, the Pods of each old RTResource
+       are adopted by its mirror and the old RTResource is deleted.
+If the migration does not complete, the old RTResources (and the Pods
+not adopted yet) are kept and the migration is resumed at the next startup.
+It returns the number of migrated RTResources.
+*/
+pub async fn migrate_rtresources(client: Client, config: &ControllerConfig) -> Result<usize, Box<dyn Error>> {
+    let (group, version) = config.migrate_from_group
+        .split_once('/')
+        .ok_or_else(|| format!("invalid GroupVersion '{}'", config.migrate_from_group))?;
+    let resource = ApiResource::from_gvk(&GroupVersionKind::gvk(group, version, "RTResource"));
+
+    let mut old_rtresources: Vec<DynamicObject> = Vec::new();
+    for api in old_rtresource_apis(client.clone(), config, &resource) {
+        old_rtresources.extend(api.list(&ListParams::default()).await?.items);
+    }
+    if old_rtresources.is_empty() {
+        return Ok(0);
+    }
+
+    let mut mirrors: Vec<(DynamicObject, RTResource)> = Vec::new();
+    for old in old_rtresources {
+        let new = mirror_rtresource(client.clone(), &old).await?;
+        mirrors.push((old, new));
+    }
+
+    let mismatches: Vec<String> = mirrors
+        .iter()
+        .filter(|(old, new)| !check_parity(old, new))
+        .map(|(old, _)| format!("{}/{}", old.namespace().unwrap_or_default(), old.name_any()))
+        .collect();
+    if !mismatches.is_empty() {
+        return Err(format!("the following RTResources differ from their mirror: {}", mismatches.join(", ")).into());
+    }
+
+    for (old, new) in mirrors.iter() {
+        adopt_pods(client.clone(), old, new).await?;
+        delete_old_rtresource(client.clone(), &resource, old).await?;
+    }
+
+    Ok(mirrors.len())
+}
@@ -1,3 +1,12 @@
 pub mod configuration;
 pub mod vars;
-pub mod rtresource;
\ No newline at end of file
+pub mod rtresource;
+pub mod conditions;
+pub mod scale_rate;
+pub mod rbac;
+pub mod profiles;
+pub mod finalizer;
+pub mod decisions;
+pub mod migration;
+pub mod resync;
+pub mod rtplan;
\ No newline at end of file
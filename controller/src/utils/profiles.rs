@@ -0,0 +1,234 @@
+/*
+This file contains the per-criticality default resource profiles
+applied to the containers of managed Pods that do not specify
+explicit resource requests.
+*/
+
+use std::{
+    fmt,
+    collections::BTreeMap
+};
+use k8s_openapi::{
+    api::core::v1::{
+        PodSpec,
+        ResourceRequirements
+    },
+    apimachinery::pkg::api::resource::Quantity
+};
+
+
+
+/*
+Default resource profile for a range of criticality levels
+*/
+#[derive(Clone)]
+pub struct ResourceProfile {
+    pub min_criticality: u32,       // First criticality level of the range
+    pub max_criticality: u32,       // Last criticality level of the range
+    pub cpu: Option<String>,        // Default CPU request
+    pub memory: Option<String>,     // Default Memory request
+    pub guaranteed: bool,           // Whether limits must match requests (Guaranteed QoS)
+}
+
+/*
+This function implements the Display trait for the
+ResourceProfile struct to allow easy printing of its values.
+*/
+impl fmt::Display for ResourceProfile {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{}-{}: cpu={}, memory={}, guaranteed={}",
+            self.min_criticality,
+            self.max_criticality,
+            self.cpu.as_deref().unwrap_or("-"),
+            self.memory.as_deref().unwrap_or("-"),
+            self.guaranteed
+        )
+    }
+}
+
+/*
+This function checks whether the value is a valid non-negative
+Kubernetes quantity, i.e. a decimal number followed by an optional
+binary SI suffix (Ki, Mi, ...), decimal SI suffix (m, k, M, ...)
+or decimal exponent (e.g. "1e3").
+*/
+fn is_valid_quantity(value: &str) -> bool {
+    let number_end = value
+        .find(|c: char| !(c.is_ascii_digit() || c == '.' || c == '+'))
+        .unwrap_or(value.len());
+    let (number, suffix) = value.split_at(number_end);
+    let number = number.strip_prefix('+').unwrap_or(number);
+    let (integer, fraction) = number.split_once('.').unwrap_or((number, ""));
+    if integer.is_empty() && fraction.is_empty()
+        || !integer.chars().all(|c| c.is_ascii_digit())
+        || !fraction.chars().all(|c| c.is_ascii_digit()) {
+        return false;
+    }
+    match suffix {
+        "" | "n" | "u" | "m" | "k" | "M" | "G" | "T" | "P" | "E" => true,
+        "Ki" | "Mi" | "Gi" | "Ti" | "Pi" | "Ei" => true,
+        _ => match suffix.strip_prefix(|c: char| c == 'e' || c == 'E') {
+            Some(exponent) => {
+                let exponent = exponent.strip_prefix(|c: char| c == '+' || c == '-').unwrap_or(exponent);
+                !exponent.is_empty() && exponent.chars().all(|c| c.is_ascii_digit())
+            }
+            None => false,
+        },
+    }
+}
+
+/*
+This function parses a single profile entry in the form
+"<min>-<max>:cpu=<cpu>,memory=<memory>,guaranteed=<true|false>"
+(a single criticality level can be used instead of a range).
+*/
+fn parse_resource_profile(entry: &str) -> Result<ResourceProfile, String> {
+    let (range, settings) = entry.split_once(':')
+        .ok_or_else(|| format!("missing ':' in profile '{}'", entry))?;
+    let (min, max) = match range.split_once('-') {
+        Some((min, max)) => (min.trim(), max.trim()),
+        None => (range.trim(), range.trim()),
+    };
+    let mut profile = ResourceProfile {
+        min_criticality: min.parse().map_err(|_| format!("invalid criticality '{}'", min))?,
+        max_criticality: max.parse().map_err(|_| format!("invalid criticality '{}'", max))?,
+        cpu: None,
+        memory: None,
+        guaranteed: false,
+    };
+    if profile.min_criticality > profile.max_criticality {
+        return Err(format!("invalid criticality range '{}'", range));
+    }
+    for setting in settings.split(',').map(|s| s.trim()).filter(|s| !s.is_empty()) {
+        let (key, value) = setting.split_once('=')
+            .ok_or_else(|| format!("missing '=' in setting '{}'", setting))?;
+        match key.trim() {
+            "cpu" | "memory" if !is_valid_quantity(value.trim()) => {
+                return Err(format!("invalid {} quantity '{}'", key.trim(), value.trim()));
+            }
+            "cpu" => profile.cpu = Some(value.trim().to_string()),
+            "memory" => profile.memory = Some(value.trim().to_string()),
+            "guaranteed" => profile.guaranteed = value.trim()
+                .parse()
+                .map_err(|_| format!("invalid guaranteed value '{}'", value))?,
+            other => return Err(format!("unknown setting '{}'", other)),
+        }
+    }
+
+    Ok(profile)
+}
+
+/*
+This function parses the resource profiles table, whose
+entries are separated by ';'. Invalid entries are skipped.
+*/
+pub fn parse_resource_profiles(table: &str) -> Vec<ResourceProfile> {
+    let mut profiles: Vec<ResourceProfile> = Vec::new();
+    for entry in table.split(';').map(|e| e.trim()).filter(|e| !e.is_empty()) {
+        match parse_resource_profile(entry) {
+            Ok(profile) => profiles.push(profile),
+            Err(e) => eprintln!("Configuration - Skipping invalid resource profile: {}!", e),
+        }
+    }
+
+    profiles
+}
+
+/*
+This function returns the first profile
+matching the given criticality level.
+*/
+pub fn find_resource_profile(profiles: &[ResourceProfile], criticality: u32) -> Option<&ResourceProfile> {
+    profiles.iter()
+        .find(|p| p.min_criticality <= criticality && criticality <= p.max_criticality)
+}
+
+/*
+This function applies the given profile to all the containers
+of the Pod spec that do not specify any resource request or limit
+(when only limits are set, Kubernetes already derives the requests
+from them). Containers with explicit resources are left untouched.
+*/
+pub fn apply_resource_profile(pod_spec: &mut PodSpec, profile: &ResourceProfile) {
+    let mut defaults: BTreeMap<String, Quantity> = BTreeMap::new();
+    if let Some(cpu) = profile.cpu.as_ref() {
+        defaults.insert("cpu".to_string(), Quantity(cpu.clone()));
+    }
+    if let Some(memory) = profile.memory.as_ref() {
+        defaults.insert("memory".to_string(), Quantity(memory.clone()));
+    }
+    if defaults.is_empty() {
+        return;
+    }
+
+    for container in pod_spec.containers.iter_mut() {
+        let resources = container.resources.get_or_insert_with(ResourceRequirements::default);
+        let has_requests = resources.requests
+            .as_ref()
+            .map(|r| !r.is_empty())
+            .unwrap_or(false);
+        let has_limits = resources.limits
+            .as_ref()
+            .map(|l| !l.is_empty())
+            .unwrap_or(false);
+        if has_requests || has_limits {
+            continue;
+        }
+        resources.requests = Some(defaults.clone());
+        if profile.guaranteed {
+            resources.limits = Some(defaults.clone());
+        }
+    }
+}
+
+
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn valid_quantities() {
+        for value in ["1", "500m", "0.5", ".5", "+2", "128Mi", "2Gi", "1k", "1e3", "1E-2", "3e+1"] {
+            assert!(is_valid_quantity(value), "{} should be valid", value);
+        }
+    }
+
+    #[test]
+    fn invalid_quantities() {
+        for value in ["", ".", "-1", "m", "1mi", "1KiB", "1e", "1e+", "one", "1.2.3", "1 Gi"] {
+            assert!(!is_valid_quantity(value), "{} should be invalid", value);
+        }
+    }
+
+    #[test]
+    fn parse_ranges_and_single_levels() {
+        let profiles = parse_resource_profiles("1-10:cpu=100m,memory=64Mi; 90:cpu=1,guaranteed=true");
+        assert_eq!(profiles.len(), 2);
+        assert_eq!((profiles[0].min_criticality, profiles[0].max_criticality), (1, 10));
+        assert_eq!(profiles[0].cpu.as_deref(), Some("100m"));
+        assert_eq!(profiles[0].memory.as_deref(), Some("64Mi"));
+        assert!(!profiles[0].guaranteed);
+        assert_eq!((profiles[1].min_criticality, profiles[1].max_criticality), (90, 90));
+        assert_eq!(profiles[1].cpu.as_deref(), Some("1"));
+        assert_eq!(profiles[1].memory, None);
+        assert!(profiles[1].guaranteed);
+    }
+
+    #[test]
+    fn parse_skips_invalid_entries() {
+        let table = "10-1:cpu=1;1-5:cpu=lots;1-5;1-5:disk=1Gi;1-5:guaranteed=yes;x-5:cpu=1;20-30:memory=1Gi";
+        let profiles = parse_resource_profiles(table);
+        assert_eq!(profiles.len(), 1);
+        assert_eq!(profiles[0].min_criticality, 20);
+        assert_eq!(profiles[0].memory.as_deref(), Some("1Gi"));
+    }
+
+    #[test]
+    fn parse_empty_table() {
+        assert!(parse_resource_profiles("").is_empty());
+        assert!(parse_resource_profiles(" ; ").is_empty());
+    }
+}
@@ -0,0 +1,219 @@
+/*
+This file contains the startup check of the permissions
+the Preempt-K8s controller needs on the Kubernetes API Server,
+so that missing ones are reported precisely before the
+controller pipeline is started.
+*/
+
+use k8s_openapi::api::{
+    authorization::v1::{
+        SelfSubjectAccessReview,
+        SelfSubjectAccessReviewSpec,
+        ResourceAttributes
+    },
+    core::v1::ObjectReference
+};
+use kube::{
+    Api,
+    Client,
+    api::PostParams,
+    runtime::events::{
+        Event,
+        EventType,
+        Recorder,
+        Reporter
+    }
+};
+
+use crate::utils::configuration::ControllerConfig;
+
+
+
+/*
+Permission required by the controller
+*/
+pub struct Permission<'a> {
+    pub group: &'a str,
+    pub resource: &'a str,
+    pub subresource: &'a str,
+    pub verb: &'a str,
+    pub namespaced: bool,
+}
+
+impl Permission<'_> {
+    fn describe(&self) -> String {
+        let mut resource = self.resource.to_string();
+        if !self.subresource.is_empty() {
+            resource = format!("{}/{}", resource, self.subresource);
+        }
+        if !self.group.is_empty() {
+            resource = format!("{}.{}", resource, self.group);
+        }
+        format!("{} {}", self.verb, resource)
+    }
+}
+
+/*
+Permissions the controller needs on RTResources
+and their related Pods
+*/
+pub const REQUIRED_PERMISSIONS: &[Permission] = &[
+    Permission { group: "rtgroup.critical.com", resource: "rtresources", subresource: "", verb: "get", namespaced: true },
+    Permission { group: "rtgroup.critical.com", resource: "rtresources", subresource: "", verb: "list", namespaced: true },
+    Permission { group: "rtgroup.critical.com", resource: "rtresources", subresource: "", verb: "watch", namespaced: true },
+    Permission { group: "rtgroup.critical.com", resource: "rtresources", subresource: "", verb: "patch", namespaced: true },
+    Permission { group: "rtgroup.critical.com", resource: "rtresources", subresource: "status", verb: "update", namespaced: true },
+    Permission { group: "", resource: "pods", subresource: "", verb: "list", namespaced: true },
+    Permission { group: "", resource: "pods", subresource: "", verb: "watch", namespaced: true },
+    Permission { group: "", resource: "pods", subresource: "", verb: "create", namespaced: true },
+    Permission { group: "", resource: "pods", subresource: "", verb: "delete", namespaced: true },
+    Permission { group: "", resource: "pods", subresource: "", verb: "patch", namespaced: true },
+];
+
+/*
+Permission needed to publish Events on the controller Pod
+(checked in the namespace of the controller)
+*/
+pub const EVENT_PERMISSION: Permission =
+    Permission { group: "events.k8s.io", resource: "events", subresource: "", verb: "create", namespaced: true };
+
+/*
+Additional permissions needed by the drain assistant
+*/
+pub const DRAIN_ASSIST_PERMISSIONS: &[Permission] = &[
+    Permission { group: "", resource: "pods", subresource: "", verb: "get", namespaced: true },
+    Permission { group: "", resource: "nodes", subresource: "", verb: "list", namespaced: false },
+    Permission { group: "", resource: "nodes", subresource: "", verb: "patch", namespaced: false },
+];
+
+/*
+Additional permissions needed by the plan applier
+*/
+pub const RT_PLAN_PERMISSIONS: &[Permission] = &[
+    Permission { group: "rtgroup.critical.com", resource: "rtplans", subresource: "", verb: "list", namespaced: true },
+    Permission { group: "rtgroup.critical.com", resource: "rtplans", subresource: "", verb: "watch", namespaced: true },
+    Permission { group: "rtgroup.critical.com", resource: "rtplans", subresource: "status", verb: "patch", namespaced: true },
+];
+
+/*
+Verbs needed on the RTResources of the old group
+(only if the migration is enabled)
+*/
+pub const MIGRATION_VERBS: &[&str] = &["get", "list", "patch", "delete"];
+
+/*
+This function asks the API Server, through a SelfSubjectAccessReview,
+whether the controller is allowed to perform the given action
+in the given namespace (cluster-wide if None).
+*/
+async fn is_allowed(client: Client, permission: &Permission, namespace: Option<&String>) -> Result<bool, kube::Error> {
+    let reviews: Api<SelfSubjectAccessReview> = Api::all(client);
+    let review = SelfSubjectAccessReview {
+        spec: SelfSubjectAccessReviewSpec {
+            resource_attributes: Some(ResourceAttributes {
+                namespace: namespace.cloned(),
+                group: Some(permission.group.to_string()),
+                resource: Some(permission.resource.to_string()),
+                subresource: if permission.subresource.is_empty() {
+                    None
+                } else {
+                    Some(permission.subresource.to_string())
+                },
+                verb: Some(permission.verb.to_string()),
+                ..Default::default()
+            }),
+            ..Default::default()
+        },
+        ..Default::default()
+    };
+    let result = reviews.create(&PostParams::default(), &review).await?;
+
+    Ok(result.status.map(|s| s.allowed).unwrap_or(false))
+}
+
+/*
+This function checks all the permissions required by the controller
+(depending on the enabled components) and returns the description
+of the missing ones.
+If the migration is enabled, the RTResources of the old group
+are checked as well.
+Namespaced permissions are checked in every watched namespace
+when the controller is namespace-scoped, except for the Events
+one, checked in the namespace Events are published in.
+If a review cannot be performed, the permission is reported as missing
+together with the error that occurred.
+*/
+pub async fn find_missing_permissions(client: Client, config: &ControllerConfig) -> Vec<String> {
+    let mut permissions: Vec<&Permission> = REQUIRED_PERMISSIONS.iter().collect();
+    if config.drain_assist {
+        permissions.extend(DRAIN_ASSIST_PERMISSIONS.iter());
+    }
+    if config.rt_plans {
+        permissions.extend(RT_PLAN_PERMISSIONS.iter());
+    }
+    let old_group = config.migrate_from_group.split_once('/').map(|(group, _)| group);
+    let migration_permissions: Vec<Permission> = match old_group {
+        Some(group) => MIGRATION_VERBS
+            .iter()
+            .map(|&verb| Permission { group, resource: "rtresources", subresource: "", verb, namespaced: true })
+            .collect(),
+        None => Vec::new(),
+    };
+    permissions.extend(migration_permissions.iter());
+
+    let mut checks: Vec<(&Permission, Option<&String>)> = Vec::new();
+    for permission in permissions {
+        if permission.namespaced && !config.watch_namespaces.is_empty() {
+            checks.extend(config.watch_namespaces.iter().map(|ns| (permission, Some(ns))));
+        } else {
+            checks.push((permission, None));
+        }
+    }
+    checks.push((&EVENT_PERMISSION, Some(&config.pod_namespace)));
+
+    let mut missing: Vec<String> = Vec::new();
+    for (permission, namespace) in checks {
+        let description = match namespace {
+            Some(ns) => format!("{} in namespace {}", permission.describe(), ns),
+            None => permission.describe(),
+        };
+        match is_allowed(client.clone(), permission, namespace).await {
+            Ok(true) => {}
+            Ok(false) => missing.push(description),
+            Err(e) => missing.push(format!("{} (review failed: {})", description, e)),
+        }
+    }
+
+    missing
+}
+
+/*
+This function publishes a startup Warning event on the controller Pod
+listing the missing permissions.
+Note: the event can only be published if the controller is
+allowed to create events, otherwise only the logs report the problem.
+*/
+pub async fn report_missing_permissions(client: Client, config: &ControllerConfig, missing: &Vec<String>) {
+    let reporter = Reporter {
+        controller: "preempt-k8s".to_string(),
+        instance: Some(config.pod_name.clone()),
+    };
+    let reference = ObjectReference {
+        api_version: Some("v1".to_string()),
+        kind: Some("Pod".to_string()),
+        name: Some(config.pod_name.clone()),
+        namespace: Some(config.pod_namespace.clone()),
+        ..Default::default()
+    };
+    let recorder = Recorder::new(client, reporter, reference);
+    let event = Event {
+        type_: EventType::Warning,
+        reason: "MissingPermissions".to_string(),
+        note: Some(format!("The controller is missing the following permissions: {}", missing.join(", "))),
+        action: "StartupCheck".to_string(),
+        secondary: None,
+    };
+    if let Err(e) = recorder.publish(event).await {
+        eprintln!("RBAC Check - An error occurred while publishing the startup event: {}", e);
+    }
+}
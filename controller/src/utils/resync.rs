@@ -0,0 +1,160 @@
+/*
+This file contains the scheduling of the periodic RTResources resync:
+each RTResource is periodically requeued so that a watchdog reconciles
+it again, with a per-RTResource offset derived from its UID so that
+the resyncs (and the related API Server writes) are spread over time
+instead of happening all at the same tick.
+*/
+
+use std::{
+    collections::{
+        HashMap,
+        HashSet,
+        hash_map::DefaultHasher
+    },
+    hash::{
+        Hash,
+        Hasher
+    },
+    time::{
+        Duration,
+        Instant
+    }
+};
+
+
+
+/*
+This function returns the resync offset of the RTResource,
+a stable value in [0, jitter] derived from its UID.
+*/
+pub fn resync_offset(uid: &str, jitter: Duration) -> Duration {
+    let jitter_ms = jitter.as_millis() as u64;
+    if jitter_ms == 0 {
+        return Duration::ZERO;
+    }
+    let mut hasher = DefaultHasher::new();
+    uid.hash(&mut hasher);
+    Duration::from_millis(hasher.finish() % (jitter_ms + 1))
+}
+
+/*
+Resync schedule struct, it tracks when
+each RTResource was last resynced.
+*/
+pub struct ResyncSchedule {
+    period: Duration,
+    jitter: Duration,
+    last_resync: HashMap<String, Instant>,
+}
+
+impl ResyncSchedule {
+    pub fn new(period: Duration, jitter: Duration) -> Self {
+        ResyncSchedule {
+            period: period,
+            jitter: jitter,
+            last_resync: HashMap::new(),
+        }
+    }
+
+    /*
+    This function checks whether the RTResource must be resynced,
+    i.e. whether its period plus its offset elapsed since the last resync.
+    RTResources seen for the first time are not resynced immediately:
+    their first resync happens a full period (plus offset) later,
+    also for those already deployed when the controller starts
+    (the CRD watcher does not report them at startup).
+    */
+    pub fn is_due(&mut self, uid: &str) -> bool {
+        if self.period.is_zero() {
+            return false;
+        }
+        let now = Instant::now();
+        let due_after = self.period + resync_offset(uid, self.jitter);
+        match self.last_resync.get_mut(uid) {
+            Some(last) if now.duration_since(*last) >= due_after => {
+                *last = now;
+                true
+            }
+            Some(_) => false,
+            None => {
+                self.last_resync.insert(uid.to_string(), now);
+                false
+            }
+        }
+    }
+
+    /*
+    This function forgets the RTResources no longer deployed.
+    */
+    pub fn retain(&mut self, uids: &HashSet<String>) {
+        self.last_resync.retain(|uid, _| uids.contains(uid));
+    }
+}
+
+
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const PERIOD: Duration = Duration::from_secs(60);
+    const JITTER: Duration = Duration::from_secs(10);
+
+    fn backdate(schedule: &mut ResyncSchedule, uid: &str, elapsed: Duration) {
+        schedule.last_resync.insert(uid.to_string(), Instant::now().checked_sub(elapsed).unwrap());
+    }
+
+    #[test]
+    fn offset_is_stable_and_bounded() {
+        for uid in ["a", "b", "4f6c1e9a-2b1d-4c7e-9f3a-0d2e5b8c7a61"] {
+            let offset = resync_offset(uid, JITTER);
+            assert!(offset <= JITTER);
+            assert_eq!(offset, resync_offset(uid, JITTER));
+        }
+    }
+
+    #[test]
+    fn offset_without_jitter() {
+        assert_eq!(resync_offset("a", Duration::ZERO), Duration::ZERO);
+    }
+
+    #[test]
+    fn first_sight_is_not_due() {
+        let mut schedule = ResyncSchedule::new(PERIOD, JITTER);
+        assert!(!schedule.is_due("a"));
+        assert!(!schedule.is_due("a"));
+    }
+
+    #[test]
+    fn due_after_period_plus_offset() {
+        let mut schedule = ResyncSchedule::new(PERIOD, JITTER);
+        backdate(&mut schedule, "a", PERIOD + JITTER);
+        assert!(schedule.is_due("a"));
+        assert!(!schedule.is_due("a"));
+    }
+
+    #[test]
+    fn not_due_before_period() {
+        let mut schedule = ResyncSchedule::new(PERIOD, JITTER);
+        backdate(&mut schedule, "a", PERIOD - Duration::from_secs(1));
+        assert!(!schedule.is_due("a"));
+    }
+
+    #[test]
+    fn zero_period_disables_resync() {
+        let mut schedule = ResyncSchedule::new(Duration::ZERO, JITTER);
+        backdate(&mut schedule, "a", PERIOD);
+        assert!(!schedule.is_due("a"));
+    }
+
+    #[test]
+    fn retain_forgets_removed_rtresources() {
+        let mut schedule = ResyncSchedule::new(PERIOD, JITTER);
+        backdate(&mut schedule, "a", PERIOD + JITTER);
+        backdate(&mut schedule, "b", PERIOD + JITTER);
+        schedule.retain(&HashSet::from(["b".to_string()]));
+        assert!(!schedule.is_due("a"));
+        assert!(schedule.is_due("b"));
+    }
+}
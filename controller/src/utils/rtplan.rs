@@ -0,0 +1,94 @@
+/*
+This file contains the custom resource
+specification for the RTPlan, the aggregate resource
+through which the scaler submits, in a single write,
+the desired state of a batch of RTResources.
+*/
+
+use kube::CustomResource;
+use schemars::JsonSchema;
+use serde::{
+    Deserialize,
+    Serialize
+};
+
+use crate::utils::rtresource::RTResource;
+
+
+
+/*
+Annotation recording, on the RTResources updated by a plan,
+the plan (and its generation) that last wrote their desired state
+*/
+pub const PLAN_ANNOTATION: &str = "rtgroup.critical.com/plan";
+
+/*
+Annotation marking the RTResources whose desired state was
+written by a plan not committed yet: the watchdogs do not act
+on them until the annotation is removed
+*/
+pub const PLAN_STAGED_ANNOTATION: &str = "rtgroup.critical.com/plan-staged";
+
+/*
+Plan phases reported in the RTPlan status
+*/
+pub const PLAN_APPLIED: &str = "Applied";
+pub const PLAN_FAILED: &str = "Failed";
+
+/*
+Desired state of a single RTResource
+*/
+#[derive(Deserialize, Serialize, Clone, Debug, JsonSchema)]
+pub struct PlanEntry {
+    /*
+    Name of the RTResource
+    */
+    pub name: String,
+    /*
+    Namespace of the RTResource
+    (the namespace of the plan if not set,
+    it must match it otherwise)
+    */
+    pub namespace: Option<String>,
+    /*
+    Desired number of replicas
+    */
+    pub replicas: i32,
+}
+
+/*
+RTPlan specification
+*/
+#[derive(CustomResource, Deserialize, Serialize, Clone, Debug, JsonSchema)]
+#[kube(group = "rtgroup.critical.com", version = "v1", kind = "RTPlan", namespaced, status = "RTPlanStatus")]
+pub struct RTPlanSpec {
+    /*
+    Desired state of the RTResources
+    in the reconcile batch
+    */
+    pub entries: Vec<PlanEntry>,
+}
+
+/*
+RTPlan status specification
+*/
+#[derive(Deserialize, Serialize, Clone, Debug, JsonSchema, Default)]
+pub struct RTPlanStatus {
+    #[serde(rename = "observedGeneration")]
+    pub observed_generation: Option<i64>,
+    pub phase: Option<String>,
+    #[serde(rename = "appliedEntries")]
+    pub applied_entries: Option<i32>,
+    pub message: Option<String>,
+}
+
+/*
+This function returns the plan (and its generation)
+that staged the desired state of the RTResource,
+if not committed yet.
+*/
+pub fn staged_plan(rtresource: &RTResource) -> Option<&String> {
+    rtresource.metadata.annotations
+        .as_ref()
+        .and_then(|a| a.get(PLAN_STAGED_ANNOTATION))
+}
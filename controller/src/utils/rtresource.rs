@@ -13,10 +13,88 @@ use serde::{
 };
 use k8s_openapi::{
     apimachinery::pkg::apis::meta::v1::ObjectMeta,
-    api::core::v1::PodSpec
+    api::core::v1::{
+        Pod,
+        PodSpec
+    }
 };
 
 
+/*
+Annotation marking an RTResource update as urgent
+(e.g. the autoscaler entered panic mode for the service)
+*/
+pub const URGENT_ANNOTATION: &str = "rtgroup.critical.com/urgent";
+
+/*
+Readiness gate condition type, set on managed Pods by the
+node agent once the RT scheduling parameters (cpuset,
+SCHED_DEADLINE) have been applied to their containers
+*/
+pub const RT_READINESS_GATE: &str = "rtgroup.critical.com/rt-configured";
+
+/*
+Annotation marking the Pods retained after
+the deletion of their RTResource
+*/
+pub const RETAINED_ANNOTATION: &str = "rtgroup.critical.com/retained";
+
+/*
+Annotation recording, on a Pod running on a cordoned node,
+the name of the Pod created to replace it
+*/
+pub const DRAIN_REPLACEMENT_ANNOTATION: &str = "rtgroup.critical.com/drain-replacement";
+
+/*
+Annotation reporting, on a cordoned Node,
+the progress of the drain of its RTResource related Pods
+*/
+pub const DRAIN_PROGRESS_ANNOTATION: &str = "rtgroup.critical.com/rt-drain-progress";
+
+/*
+Annotation set by a managed Pod while it is executing deadline-critical
+work, holding the RFC 3339 time the work started: the Pod is not removed
+on scale down until the annotation is removed or the busy timeout expires
+*/
+pub const BUSY_ANNOTATION: &str = "rtgroup.critical.com/busy-since";
+
+/*
+Label marking the debug replica of an RTResource, which is
+exempt from RT guarantees and from the replicas accounting
+*/
+pub const DEBUG_LABEL: &str = "rtgroup.critical.com/debug";
+
+/*
+Label carrying, on the debug replica, the criticality of its
+RTResource in place of the "criticality" label, so that its events
+are still handled while no RT scheduling parameters are applied to it
+*/
+pub const DEBUG_CRITICALITY_LABEL: &str = "rtgroup.critical.com/debug-criticality";
+
+/*
+Annotation recording, on an RTResource whose event was still
+pending when the controller shut down, that it must be reconciled
+by the next controller instance ("urgent" or "normal")
+*/
+pub const PENDING_INTENT_ANNOTATION: &str = "rtgroup.critical.com/pending-intent";
+
+/*
+Deletion policy specification: it defines what happens
+to the managed Pods when the RTResource is deleted
+    - Delete: the Pods are deleted (default);
+    - Retain: the Pods are kept as they are and marked as retained,
+      the controller no longer acts on them;
+    - Orphan: the Pods are kept but detached from the RTResource
+      by removing the controller labels.
+*/
+#[derive(Deserialize, Serialize, Clone, Copy, Debug, JsonSchema, PartialEq, Default)]
+pub enum DeletionPolicy {
+    #[default]
+    Delete,
+    Retain,
+    Orphan,
+}
+
 /*
 Pod template specification
 */
@@ -74,6 +152,31 @@ pub struct RTResourceSpec {
     */
     pub criticality: u32,
     /*
+    Maximum number of replicas that
+    can be added per minute
+    */
+    #[serde(rename = "maxScaleUpRate")]
+    pub max_scale_up_rate: Option<i32>,
+    /*
+    Maximum number of replicas that
+    can be removed per minute
+    */
+    #[serde(rename = "maxScaleDownRate")]
+    pub max_scale_down_rate: Option<i32>,
+    /*
+    What happens to the managed Pods
+    when the RTResource is deleted
+    */
+    #[serde(rename = "deletionPolicy")]
+    pub deletion_policy: Option<DeletionPolicy>,
+    /*
+    Whether an extra replica for debugging or
+    profiling, exempt from RT guarantees and
+    from the replicas accounting, is deployed
+    */
+    #[serde(rename = "debugReplica")]
+    pub debug_replica: Option<bool>,
+    /*
     Pod template
     */
     pub template: Template,
@@ -104,4 +207,158 @@ pub struct RTResourceStatus {
     pub desired_replicas: Option<i32>,
     pub replicas: Option<i32>,
     pub conditions: Option<Vec<Condition>>,
+    #[serde(rename = "coldStartLatencyMs")]
+    pub cold_start_latency_ms: Option<i64>,
+    #[serde(rename = "scaleUpAdmittedAt")]
+    pub scale_up_admitted_at: Option<String>,
+}
+
+/*
+This function returns the time elapsed (in milliseconds) since
+the controller admitted the pending scale up from zero replicas
+of the RTResource, if any.
+*/
+pub fn scale_up_admitted_for_ms(status: &RTResourceStatus) -> Option<i64> {
+    status.scale_up_admitted_at
+        .as_ref()
+        .and_then(|t| chrono::DateTime::parse_from_rfc3339(t).ok())
+        .map(|t| (chrono::Utc::now() - t.with_timezone(&chrono::Utc)).num_milliseconds())
+}
+
+/*
+This function checks whether the RTResource
+update was marked as urgent.
+*/
+pub fn is_urgent(rtresource: &RTResource) -> bool {
+    rtresource.metadata.annotations
+        .as_ref()
+        .and_then(|a| a.get(URGENT_ANNOTATION))
+        .map(|v| v == "true")
+        .unwrap_or(false)
+}
+
+/*
+This function returns the event left pending on the RTResource
+by a previous controller instance, if any
+(Some(true) if the event was urgent).
+*/
+pub fn pending_intent(rtresource: &RTResource) -> Option<bool> {
+    rtresource.metadata.annotations
+        .as_ref()
+        .and_then(|a| a.get(PENDING_INTENT_ANNOTATION))
+        .map(|v| v == "urgent")
+}
+
+/*
+This function checks whether the
+Pod was retained after the deletion
+of its RTResource.
+*/
+pub fn is_retained(pod: &Pod) -> bool {
+    pod.metadata.annotations
+        .as_ref()
+        .and_then(|a| a.get(RETAINED_ANNOTATION))
+        .map(|v| v == "true")
+        .unwrap_or(false)
+}
+
+/*
+This function checks whether the Pod
+is the debug replica of its RTResource.
+*/
+pub fn is_debug(pod: &Pod) -> bool {
+    pod.metadata.labels
+        .as_ref()
+        .and_then(|l| l.get(DEBUG_LABEL))
+        .map(|v| v == "true")
+        .unwrap_or(false)
+}
+
+/*
+This function checks whether the Pod is executing
+deadline-critical work, i.e. whether it carries the busy
+annotation and the busy timeout (in seconds) did not expire.
+An unparsable annotation, or one set in the future, is timed out
+from the Pod creation, so that a malformed value cannot keep
+the Pod busy forever.
+*/
+pub fn is_busy(pod: &Pod, timeout: u64) -> bool {
+    let now = chrono::Utc::now();
+    let since = match pod.metadata.annotations.as_ref().and_then(|a| a.get(BUSY_ANNOTATION)) {
+        Some(since) => chrono::DateTime::parse_from_rfc3339(since)
+            .ok()
+            .map(|since| since.with_timezone(&chrono::Utc))
+            .filter(|since| *since <= now)
+            .or_else(|| pod.metadata.creation_timestamp.as_ref().map(|t| t.0)),
+        None => None,
+    };
+    match since {
+        Some(since) => (now - since).num_seconds() < timeout as i64,
+        None => false,
+    }
+}
+
+/*
+This function checks whether the RT scheduling
+parameters were applied to the Pod, i.e. whether
+its RT readiness gate condition is "True".
+*/
+pub fn is_rt_configured(pod: &Pod) -> bool {
+    pod.status
+        .as_ref()
+        .and_then(|s| s.conditions.as_ref())
+        .map(|conditions| conditions.iter().any(|c| c.type_ == RT_READINESS_GATE && c.status == "True"))
+        .unwrap_or(false)
+}
+
+
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use k8s_openapi::apimachinery::pkg::apis::meta::v1::Time;
+
+    fn pod(busy_since: Option<String>, created_secs_ago: i64) -> Pod {
+        let created = chrono::Utc::now() - chrono::Duration::seconds(created_secs_ago);
+        Pod {
+            metadata: ObjectMeta {
+                annotations: busy_since.map(|since| BTreeMap::from([(BUSY_ANNOTATION.to_string(), since)])),
+                creation_timestamp: Some(Time(created)),
+                ..Default::default()
+            },
+            ..Default::default()
+        }
+    }
+
+    fn secs_ago(secs: i64) -> String {
+        (chrono::Utc::now() - chrono::Duration::seconds(secs)).to_rfc3339()
+    }
+
+    #[test]
+    fn not_busy_without_annotation() {
+        assert!(!is_busy(&pod(None, 0), 60));
+    }
+
+    #[test]
+    fn busy_until_timeout() {
+        assert!(is_busy(&pod(Some(secs_ago(10)), 100), 60));
+        assert!(!is_busy(&pod(Some(secs_ago(120)), 200), 60));
+    }
+
+    #[test]
+    fn zero_timeout_is_never_busy() {
+        assert!(!is_busy(&pod(Some(secs_ago(0)), 0), 0));
+    }
+
+    #[test]
+    fn unparsable_annotation_times_out_from_creation() {
+        assert!(is_busy(&pod(Some("soon".to_string()), 10), 60));
+        assert!(!is_busy(&pod(Some("soon".to_string()), 120), 60));
+    }
+
+    #[test]
+    fn future_annotation_times_out_from_creation() {
+        assert!(is_busy(&pod(Some(secs_ago(-3600)), 10), 60));
+        assert!(!is_busy(&pod(Some(secs_ago(-3600)), 120), 60));
+    }
 }
@@ -0,0 +1,275 @@
+/*
+This file contains the bookkeeping needed to enforce
+the scale velocity limits (maxScaleUpRate and maxScaleDownRate)
+declared in the RTResource spec.
+*/
+
+use std::{
+    time::{
+        Duration,
+        Instant
+    }
+};
+use libc::{
+    pthread_mutex_lock,
+    pthread_mutex_unlock
+};
+
+use crate::utils::vars::SharedState;
+
+
+
+/*
+Length of the window the scale velocity limits refer to
+(the limits are expressed as pods per minute)
+*/
+pub const SCALE_RATE_WINDOW: Duration = Duration::from_secs(60);
+
+/*
+Scaling direction
+*/
+#[derive(Copy, Clone, PartialEq)]
+pub enum ScaleDirection {
+    Up,
+    Down,
+}
+
+/*
+Scale window struct used to track, for a single RTResource,
+how many pods were created and deleted in the current window
+and whether a scaling action was throttled.
+*/
+#[derive(Clone)]
+pub struct ScaleWindow {
+    pub start: Instant,
+    pub scaled_up: i32,
+    pub scaled_down: i32,
+    pub throttled: bool,
+}
+
+impl ScaleWindow {
+    fn new() -> Self {
+        ScaleWindow {
+            start: Instant::now(),
+            scaled_up: 0,
+            scaled_down: 0,
+            throttled: false,
+        }
+    }
+
+    fn is_expired(&self) -> bool {
+        self.start.elapsed() >= SCALE_RATE_WINDOW
+    }
+
+    /*
+    This method reserves up to "requested" pod creations or deletions
+    in the window (a new one is started if it expired) and returns
+    how many of them are allowed by the given limit.
+    */
+    fn reserve(&mut self, requested: i32, direction: ScaleDirection, max_rate: i32) -> i32 {
+        if self.is_expired() {
+            *self = ScaleWindow::new();
+        }
+        let already_scaled = match direction {
+            ScaleDirection::Up => self.scaled_up,
+            ScaleDirection::Down => self.scaled_down,
+        };
+        let allowed = (max_rate - already_scaled).max(0).min(requested);
+        match direction {
+            ScaleDirection::Up => self.scaled_up = self.scaled_up + allowed,
+            ScaleDirection::Down => self.scaled_down = self.scaled_down + allowed,
+        }
+        if allowed < requested {
+            self.throttled = true;
+        }
+
+        allowed
+    }
+
+    /*
+    This method clears the throttled flag and returns true
+    if the window was throttled and it expired.
+    */
+    fn take_expired(&mut self) -> bool {
+        if self.throttled && self.is_expired() {
+            self.throttled = false;
+            return true;
+        }
+
+        false
+    }
+}
+
+/*
+This function reserves up to "requested" pod creations or deletions
+for the RTResource with the given UID, according to its scale velocity
+limit (None means no limit), and returns how many of them are allowed
+in the current window.
+If fewer than requested are allowed, the window is marked as throttled
+so that the RTResource can be requeued once the window expires.
+*/
+pub fn reserve_scale(
+    shared_state: *mut SharedState,
+    uid: &str,
+    requested: i32,
+    direction: ScaleDirection,
+    max_rate: Option<i32>
+) -> i32 {
+    let max_rate = match max_rate {
+        Some(rate) => rate,
+        None => return requested,
+    };
+
+    unsafe {
+        let shared_state = &mut *shared_state;
+        pthread_mutex_lock(&mut shared_state.mutex);
+        let allowed = shared_state.scale_windows
+            .entry(uid.to_string())
+            .or_insert_with(ScaleWindow::new)
+            .reserve(requested, direction, max_rate);
+        pthread_mutex_unlock(&mut shared_state.mutex);
+
+        allowed
+    }
+}
+
+/*
+This function marks the scale window of the RTResource with the given
+UID as throttled, so that the RTResource is requeued once the window
+expires even if no velocity limit applies (e.g. when some replicas
+could not be removed yet).
+*/
+pub fn defer_scale(shared_state: *mut SharedState, uid: &str) {
+    unsafe {
+        let shared_state = &mut *shared_state;
+        pthread_mutex_lock(&mut shared_state.mutex);
+        let window = shared_state.scale_windows
+            .entry(uid.to_string())
+            .or_insert_with(ScaleWindow::new);
+        if window.is_expired() {
+            *window = ScaleWindow::new();
+        }
+        window.throttled = true;
+        pthread_mutex_unlock(&mut shared_state.mutex);
+    }
+}
+
+/*
+This function checks whether the RTResource with the given UID was
+throttled and its scale window expired. If so, the throttled flag
+is cleared and the caller is in charge of requeuing the RTResource.
+*/
+pub fn take_expired_throttle(shared_state: *mut SharedState, uid: &str) -> bool {
+    unsafe {
+        let shared_state = &mut *shared_state;
+        pthread_mutex_lock(&mut shared_state.mutex);
+        let expired = match shared_state.scale_windows.get_mut(uid) {
+            Some(window) => window.take_expired(),
+            None => false,
+        };
+        pthread_mutex_unlock(&mut shared_state.mutex);
+
+        expired
+    }
+}
+
+/*
+This function returns the UIDs of the RTResources
+whose scaling is currently throttled.
+*/
+pub fn throttled_uids(shared_state: *mut SharedState) -> Vec<String> {
+    unsafe {
+        let shared_state = &mut *shared_state;
+        pthread_mutex_lock(&mut shared_state.mutex);
+        let uids = shared_state.scale_windows
+            .iter()
+            .filter(|(_, window)| window.throttled)
+            .map(|(uid, _)| uid.clone())
+            .collect();
+        pthread_mutex_unlock(&mut shared_state.mutex);
+
+        uids
+    }
+}
+
+/*
+This function drops the scale window of a deleted RTResource.
+*/
+pub fn forget_scale_window(shared_state: *mut SharedState, uid: &str) {
+    unsafe {
+        let shared_state = &mut *shared_state;
+        pthread_mutex_lock(&mut shared_state.mutex);
+        shared_state.scale_windows.remove(uid);
+        pthread_mutex_unlock(&mut shared_state.mutex);
+    }
+}
+
+
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn expired_window() -> ScaleWindow {
+        let mut window = ScaleWindow::new();
+        window.start = Instant::now().checked_sub(SCALE_RATE_WINDOW).unwrap();
+        window
+    }
+
+    #[test]
+    fn reserve_allows_up_to_the_limit() {
+        let mut window = ScaleWindow::new();
+        assert_eq!(window.reserve(2, ScaleDirection::Up, 3), 2);
+        assert!(!window.throttled);
+        assert_eq!(window.reserve(2, ScaleDirection::Up, 3), 1);
+        assert!(window.throttled);
+        assert_eq!(window.reserve(1, ScaleDirection::Up, 3), 0);
+    }
+
+    #[test]
+    fn reserve_tracks_directions_separately() {
+        let mut window = ScaleWindow::new();
+        assert_eq!(window.reserve(3, ScaleDirection::Up, 3), 3);
+        assert_eq!(window.reserve(2, ScaleDirection::Down, 3), 2);
+        assert_eq!(window.scaled_up, 3);
+        assert_eq!(window.scaled_down, 2);
+        assert!(!window.throttled);
+    }
+
+    #[test]
+    fn reserve_starts_a_new_window_once_expired() {
+        let mut window = expired_window();
+        window.scaled_up = 3;
+        window.throttled = true;
+        assert_eq!(window.reserve(2, ScaleDirection::Up, 3), 2);
+        assert_eq!(window.scaled_up, 2);
+        assert!(!window.throttled);
+    }
+
+    #[test]
+    fn reserve_with_a_zero_limit_throttles() {
+        let mut window = ScaleWindow::new();
+        assert_eq!(window.reserve(1, ScaleDirection::Down, 0), 0);
+        assert!(window.throttled);
+    }
+
+    #[test]
+    fn take_expired_only_once_the_window_expires() {
+        let mut window = ScaleWindow::new();
+        window.throttled = true;
+        assert!(!window.take_expired());
+        assert!(window.throttled);
+
+        let mut window = expired_window();
+        window.throttled = true;
+        assert!(window.take_expired());
+        assert!(!window.throttled);
+        assert!(!window.take_expired());
+    }
+
+    #[test]
+    fn take_expired_ignores_windows_not_throttled() {
+        let mut window = expired_window();
+        assert!(!window.take_expired());
+    }
+}
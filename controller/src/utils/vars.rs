@@ -3,16 +3,24 @@ This File contains useful constants and variables used
 by the Preempt-K8s controller threads.
 */
 
-use std::ffi::CString;
+use std::{
+    ffi::CString,
+    collections::HashMap,
+    sync::mpsc::Sender
+};
 use libc::{
     pthread_t,
     pthread_cond_t,
     pthread_mutex_t
 };
 use kube::{
-    Api, Client
+    Api, Client,
+    api::ListParams
+};
+use k8s_openapi::api::core::v1::{
+    Pod,
+    Node
 };
-use k8s_openapi::api::core::v1::Pod;
 use serde::{
     Deserialize,
     Serialize
@@ -24,7 +32,13 @@ use bincode::{
 use tokio::runtime::Handle;
 
 use crate::utils::rtresource::RTResource;
+use crate::utils::rtplan::RTPlan;
 use crate::utils::configuration::*;
+use crate::utils::scale_rate::ScaleWindow;
+use crate::utils::decisions::{
+    Decision,
+    start_decision_writer
+};
 
 
 
@@ -32,20 +46,85 @@ use crate::utils::configuration::*;
 Controller kubernetes Context struct
 used to store Controller-K8s communication parameters
 */
+#[derive(Clone)]
 pub struct ClientContext {
     /*
     Interface with Kubernets API Server
     */
     pub client: Client,
     /*
-    Interface with the custom resource
-    monitored by the controller
+    Interfaces with the custom resource
+    monitored by the controller: a single cluster-wide one
+    or one for each watched namespace
+    */
+    pub rt_resources: Vec<Api<RTResource>>,
+    /*
+    Interfaces with the Kubernetes pods: a single cluster-wide one
+    or one for each watched namespace
     */
-    pub rt_resources: Api<RTResource>,
+    pub pods: Vec<Api<Pod>>,
+    /*
+    Interfaces with the RTPlans: a single cluster-wide one
+    or one for each watched namespace
+    */
+    pub rt_plans: Vec<Api<RTPlan>>,
+    /*
+    Interface with the Kubernetes nodes
+    */
+    pub nodes: Api<Node>,
+}
+
+impl ClientContext {
+    /*
+    This function creates the client context, scoped to the
+    given namespaces (cluster-wide if no namespace is given).
+    */
+    pub fn new(client: Client, namespaces: &Vec<String>) -> Self {
+        let (rt_resources, pods, rt_plans) = if namespaces.is_empty() {
+            (
+                vec![Api::<RTResource>::all(client.clone())],
+                vec![Api::<Pod>::all(client.clone())],
+                vec![Api::<RTPlan>::all(client.clone())]
+            )
+        } else {
+            (
+                namespaces.iter().map(|ns| Api::<RTResource>::namespaced(client.clone(), ns)).collect(),
+                namespaces.iter().map(|ns| Api::<Pod>::namespaced(client.clone(), ns)).collect(),
+                namespaces.iter().map(|ns| Api::<RTPlan>::namespaced(client.clone(), ns)).collect()
+            )
+        };
+        ClientContext {
+            client: client.clone(),
+            rt_resources: rt_resources,
+            pods: pods,
+            rt_plans: rt_plans,
+            nodes: Api::<Node>::all(client.clone()),
+        }
+    }
+
+    /*
+    This function lists the RTResources in all
+    the namespaces watched by the controller.
+    */
+    pub async fn list_rtresources(&self, lp: &ListParams) -> Result<Vec<RTResource>, kube::Error> {
+        let mut items: Vec<RTResource> = Vec::new();
+        for api in self.rt_resources.iter() {
+            items.extend(api.list(lp).await?.items);
+        }
+        Ok(items)
+    }
+
     /*
-    Interface with the Kubernetes pods
+    This function lists the Pods in all
+    the namespaces watched by the controller.
     */
-    pub pods: Api<Pod>,
+    pub async fn list_pods(&self, lp: &ListParams) -> Result<Vec<Pod>, kube::Error> {
+        let mut items: Vec<Pod> = Vec::new();
+        for api in self.pods.iter() {
+            items.extend(api.list(lp).await?.items);
+        }
+        Ok(items)
+    }
 }
 
 /*
@@ -97,6 +176,26 @@ pub struct SharedState {
     The Workers Array
     */
     pub workers: Vec<Worker>,
+    /*
+    The scale velocity windows of the RTResources,
+    indexed by RTResource UID
+    */
+    pub scale_windows: HashMap<String, ScaleWindow>,
+    /*
+    The channel scaling decisions are logged through
+    (None if the decision log is disabled)
+    */
+    pub decision_log: Option<Sender<Decision>>,
+    /*
+    The events currently being handled by the watchdogs
+    */
+    pub in_flight: Vec<QueueMessage>,
+    /*
+    Whether the controller is shutting down: the events
+    retrieved from now on are only recorded in flight
+    (to be persisted), not handled
+    */
+    pub shutting_down: bool,
 }
 
 /*
@@ -112,13 +211,11 @@ pub fn new_shared_state(
     queue_path: &str,
     workers_number: usize
 ) -> Box<SharedState> {
+    let decision_log = start_decision_writer(&config);
+    let context = ClientContext::new(client, &config.watch_namespaces);
     Box::new(SharedState {
         config: config,
-        context: ClientContext {
-            client: client.clone(),
-            rt_resources: Api::<RTResource>::all(client.clone()),
-            pods: Api::<Pod>::all(client.clone()),
-        },
+        context: context,
         runtime_handle: runtime_handle,
         cond: cond,
         mutex: mutex,
@@ -131,9 +228,26 @@ pub fn new_shared_state(
             };
             workers_number
         ],
+        scale_windows: HashMap::new(),
+        decision_log: decision_log,
+        in_flight: Vec::new(),
+        shutting_down: false,
     })
 }
 
+/*
+Event queue priority used for urgent events,
+higher than any criticality level so that they
+are retrieved before any other pending event
+*/
+pub const URGENT_EVENT_PRIORITY: u32 = 81;
+
+/*
+Scheduling priority used by watchdogs
+while handling urgent events
+*/
+pub const URGENT_WATCHDOG_PRIORITY: i32 = 93;
+
 /*
 This struct represents the message in
 the event priority queue.
@@ -152,6 +266,11 @@ pub struct QueueMessage {
     The RTResource namespace
     */
     pub namespace: String,
+    /*
+    Whether the event must be fast-pathed
+    (e.g. the RTResource update was marked as urgent)
+    */
+    pub urgent: bool,
 }
 
 impl QueueMessage {